@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Mystik738/matchmaking-script/matchmaking"
+)
+
+func main() {
+	log.SetOutput(os.Stderr)
+
+	//Default to run so that bare invocations and flags alone keep working
+	command := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "run":
+		runCommand(args)
+	case "validate":
+		validateCommand(args)
+	case "replay":
+		replayCommand(args)
+	case "diff":
+		diffCommand(args)
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown command:", command)
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[run|validate|replay|diff] [flags]")
+		os.Exit(2)
+	}
+}
+
+func newRunFlags(config *matchmaking.Config, configPath *string, dryRun *bool, resume *string, population *string, scenarios *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.StringVar(configPath, "config", *configPath, "Path to a JSON file of Config fields. Flags given alongside it override the file.")
+	flags.BoolVar(dryRun, "dry-run", *dryRun, "Prints the effective config, after defaults, -config and flags, as JSON and exits without running.")
+	flags.StringVar(resume, "resume", *resume, "Path to a -snapshot file. Continues that run from the season after the snapshot, up to -seasons.")
+	flags.StringVar(population, "players", *population, "Path to a CSV of players to play the seasons on instead of generated ones, with columns Id, Skill Max, Skill Offset, Skill Rate, Games Per Season and Rank after a header row. Nobody else joins.")
+	flags.StringVar(scenarios, "scenarios", *scenarios, "Path to a JSON array of configs, each with a Name. Runs each one with its output in a subdirectory named after it, then prints a table of headline numbers. Flags given alongside it override every scenario.")
+	config.RegisterFlags(flags)
+
+	return flags
+}
+
+func runCommand(args []string) {
+	defaults := matchmaking.DefaultConfig()
+	config := &defaults
+	configPath := ""
+	dryRun := false
+	resume := ""
+	population := ""
+	scenarios := ""
+	newRunFlags(config, &configPath, &dryRun, &resume, &population, &scenarios).Parse(args)
+
+	if scenarios != "" {
+		if configPath != "" || resume != "" || population != "" {
+			checkError("Invalid config: ", fmt.Errorf("-scenarios brings its own configs, it can't be used with -config, -resume or -players"))
+		}
+		runScenarios(scenarios, dryRun, args)
+		return
+	}
+
+	//Flags override the file, so load it and parse them again on top
+	if configPath != "" {
+		loaded, err := matchmaking.LoadConfig(configPath)
+		checkError("Cannot load config: ", err)
+		config = &loaded
+		newRunFlags(config, &configPath, &dryRun, &resume, &population, &scenarios).Parse(args)
+	}
+	checkError("Invalid config: ", config.Validate())
+
+	if dryRun {
+		//Resolve the seed here so the printed config replays exactly
+		if config.Seed == 0 {
+			config.Seed = time.Now().UnixNano()
+		}
+		log.Println("Seed:", config.Seed)
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		checkError("Cannot write config: ", encoder.Encode(config))
+		return
+	}
+
+	if config.Runs > 1 {
+		if resume != "" {
+			checkError("Invalid config: ", fmt.Errorf("-resume continues a single simulation, it can't be used with Runs %v", config.Runs))
+		}
+		matchmaking.RunMany(config)
+		return
+	}
+
+	if population != "" {
+		if resume != "" {
+			checkError("Invalid config: ", fmt.Errorf("-players starts a new run, it can't be used with -resume"))
+		}
+		players, err := matchmaking.LoadPlayersCSV(population)
+		checkError("Cannot load players: ", err)
+		_, err = matchmaking.RunWithPlayers(players, *config)
+		checkError("Cannot run players: ", err)
+		return
+	}
+
+	sim := matchmaking.NewSimulation(*config)
+	if resume != "" {
+		var err error
+		sim, err = matchmaking.Resume(resume, *config)
+		checkError("Cannot load snapshot: ", err)
+	}
+	matchmaking.RunAndReport(sim)
+}
+
+func runScenarios(path string, dryRun bool, args []string) []matchmaking.ScenarioResult {
+	loaded, err := matchmaking.LoadScenarios(path)
+	checkError("Cannot load scenarios: ", err)
+
+	results := make([]matchmaking.ScenarioResult, 0)
+	for i := 0; i < len(loaded); i++ {
+		//Flags override every scenario
+		config := loaded[i].Config
+		unused := ""
+		newRunFlags(&config, &unused, &dryRun, &unused, &unused, &unused).Parse(args)
+		config.OutputDir = filepath.Join(config.OutputDir, loaded[i].Name)
+		if config.Runs > 1 {
+			checkError("Invalid config for scenario "+loaded[i].Name+": ", fmt.Errorf("Runs %v, each scenario is a single simulation", config.Runs))
+		}
+		checkError("Invalid config for scenario "+loaded[i].Name+": ", config.Validate())
+
+		if dryRun {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "\t")
+			checkError("Cannot write config: ", encoder.Encode(matchmaking.Scenario{Name: loaded[i].Name, Config: config}))
+			continue
+		}
+
+		//Each scenario logs its own seed, so any one of them can be replayed on its own
+		log.Println("Scenario", loaded[i].Name)
+		sim := matchmaking.NewSimulation(config)
+		matchmaking.RunAndReport(sim)
+		results = append(results, matchmaking.ScenarioResult{Name: loaded[i].Name, Seed: sim.Config.Seed, Summaries: sim.Summaries})
+	}
+
+	if !dryRun {
+		fmt.Println()
+		matchmaking.PrintScenarioTable(results)
+	}
+	return results
+}
+
+func validateCommand(args []string) {
+	//Checks a config, or a command line's worth of flags, without running anything
+	defaults := matchmaking.DefaultConfig()
+	config := &defaults
+	configPath := ""
+	scenarios := ""
+	newValidateFlags(config, &configPath, &scenarios).Parse(args)
+	if configPath != "" {
+		loaded, err := matchmaking.LoadConfig(configPath)
+		checkError("Invalid config: ", err)
+		config = &loaded
+		newValidateFlags(config, &configPath, &scenarios).Parse(args)
+	}
+	checkError("Invalid config: ", config.Validate())
+	if scenarios != "" {
+		loaded, err := matchmaking.LoadScenarios(scenarios)
+		checkError("Invalid scenarios: ", err)
+		fmt.Println(len(loaded), "scenario(s) are valid")
+	}
+	fmt.Println("Config is valid")
+}
+
+func newValidateFlags(config *matchmaking.Config, configPath *string, scenarios *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.StringVar(configPath, "config", *configPath, "Path to a JSON file of Config fields to check. Flags given alongside it override the file.")
+	flags.StringVar(scenarios, "scenarios", *scenarios, "Path to a JSON array of named configs to check as well.")
+	config.RegisterFlags(flags)
+
+	return flags
+}
+
+func replayCommand(args []string) {
+	//Plays back a run from the config -dry-run printed, so only where the output goes can change
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := flags.String("config", "", "Path to the JSON config of the run to replay, as printed by run -dry-run. It needs a Seed.")
+	outputDir := flags.String("output-dir", "", "Directory to write the replay's output to instead of the config's.")
+	flags.Parse(args)
+
+	if *configPath == "" {
+		checkError("Invalid config: ", fmt.Errorf("replay needs -config"))
+	}
+	config, err := matchmaking.LoadConfig(*configPath)
+	checkError("Cannot load config: ", err)
+	if config.Seed == 0 {
+		checkError("Invalid config: ", fmt.Errorf("%s has no Seed, so there's no run to replay", *configPath))
+	}
+	if *outputDir != "" {
+		config.OutputDir = *outputDir
+	}
+
+	if config.Runs > 1 {
+		matchmaking.RunMany(&config)
+		return
+	}
+	matchmaking.RunAndReport(matchmaking.NewSimulation(config))
+}
+
+func diffCommand(args []string) {
+	//Compares two output CSVs, such as a replay against the original
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	tolerance := flags.Float64("tolerance", 0, "Largest difference between two numbers that still counts as equal.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage:", os.Args[0], "diff [flags] a.csv b.csv")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	diffs, err := matchmaking.DiffCSV(flags.Arg(0), flags.Arg(1), *tolerance)
+	checkError("Cannot diff: ", err)
+	for i := 0; i < len(diffs); i++ {
+		fmt.Println(diffs[i])
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("No differences")
+}
+
+func checkError(message string, err error) {
+	if err != nil {
+		log.Fatal(message, err)
+	}
+}
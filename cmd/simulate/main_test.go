@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	//The simulation logs every season, keep test output to the failures
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestRunScenarios(t *testing.T) {
+	//Output files are written to the working directory
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+	path := "scenarios.json"
+	err = os.WriteFile(path, []byte(`[{"Name": "base", "Seasons": 1, "PlayersPerSeason": 100}, {"Name": "derank", "Derank": true, "PlayersPerSeason": 300, "Seasons": 2}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Flags override every scenario
+	results := runScenarios(path, false, []string{"-players-per-season", "100"})
+
+	if len(results) != 2 || len(results[0].Summaries) != 1 || len(results[1].Summaries) != 2 || results[1].Summaries[1].Players != 200 || results[1].Summaries[1].Matches == 0 {
+		t.Fatalf("got %+v", results)
+	}
+	//Each scenario writes into its own directory, and Derank changes the file name
+	files := []string{filepath.Join("base", "NoDerankNoLearn.csv"), filepath.Join("derank", "DerankNoLearn.csv")}
+	for i := 0; i < len(files); i++ {
+		if _, err := os.Stat(files[i]); err != nil {
+			t.Error(err)
+		}
+	}
+}
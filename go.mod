@@ -0,0 +1,3 @@
+module github.com/Mystik738/matchmaking-script
+
+go 1.22
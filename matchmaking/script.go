@@ -0,0 +1,3982 @@
+package matchmaking
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	//Substantial Model changes
+	Derank         = false //Allows players to de-rank on losses. Currently disabled in the game, but was part of older ranking systems.
+	GamesPerSeason = 360   //Max (+ SeasonalVariance/2), average will be half this. Average number from https://forums.cdprojektred.com/index.php?threads/deep-analysis-of-journey-performed-by-game-director-himself.11028497/
+	Learn          = false //Allows players to learn as they play more games.
+	MaxRank        = 30    //Rank new players start at, counting down to Pro Rank at 0. By default the season reset drops players a tenth of this.
+	ProRankSize    = 500   //Size of the Pro Rank leaderboard. Pro players rated inside it skip the season and keep their rank, the rest play on.
+
+	FixedGamesPerSeason = 0        //When > 0, every player gets exactly this many games each season instead of the variance based draw. Removes playtime inequality for controlled experiments.
+	RankProgressionMode = "full"   //"full" keeps a RankProgression entry for every rank reached. "summary" keeps only the most recent entry, bounding memory on long runs at the cost of the GamesToProgressPastRank history.
+	StreakScope         = "global" //"global" carries win/loss streaks across rank changes. "perRank" resets the streak whenever a player changes rank.
+	WinModel            = "linear" //"linear" rolls the match against the SkillWinWeight blend. "bradleyterry" has a beat b with probability a/(a+b) exactly. "logistic" has a beat b with probability 1/(1+exp(-k*(a-b))), k growing with SkillWinWeight.
+	MatchFormat         = "single" //"single" decides a match with one game. "bo3" plays rounds until someone wins two, each round decided like a single game, so the better player wins matches more often than rounds.
+	RatingSystem        = "pieces" //"pieces" only runs the ladder. "elo" also keeps a classic Elo rating per player, updated from every match, to compare against the ladder. "glicko" keeps a Glicko-2 rating instead, with one season as the rating period. "mmr" keeps a hidden MMR that follows each player's skill.
+	LadderType          = "pieces" //Rank system the ladder runs on. "pieces" is the game's piece and streak ladder. "simple" moves up a rank for every win and down one for every loss.
+
+	//Piece and streak rules, as of the current game version
+	PiecesPerRank     = 5  //A player needs more than this many pieces to leave a rank. Ranking up keeps whatever is left over, so the next rank starts with 1 piece after a normal win. A derank starts the lower rank with this many.
+	StreakThreshold   = 3  //Wins in a row a player needs before wins earn StreakBonusPieces
+	StreakBonusPieces = 2  //Pieces for a win on a streak, instead of 1
+	StreakBonusRank   = 7  //The streak bonus only applies above this rank
+	FreeLossRank      = 25 //Losses above this rank never cost a piece
+	LossStreakRank    = 14 //Above this rank, up to FreeLossRank, only the second loss in a row onwards costs a piece. At or below it every loss does.
+
+	NoStreakBonus = false //Every win is worth one piece, streak or not. Streaks are still counted for loss protection.
+
+	//Minor Model changes. Note that these are not always linear variables.
+	LearnFactor       = 1.0   //Affects all players. Alters slope of sigmoid by same rate for all players. Larger increases learning speed, but also increases the "just don't get it" factor for struggling players.
+	LearnScale        = 2.0   //Allows some players to learn faster than others. Alters slope of sigmoid by different rates. Should be > 0.0
+	InverseLearning   = false //If players lose skill for every game played. Non-real world.
+	InverseLearnFloor = 0.0   //Minimum skill a player can fall to with InverseLearning, capped at their max skill. Keeps veterans from sinking to near zero skill.
+	PlayersPerSeason  = 1000  //Number of new players added each season.
+	Seasons           = 12    //Number of seasons in which to run the simulation.
+	SeasonalVariance  = 360   //The change in maximum number of games played between seasons for players. Range is set at [-SV/2, SV/2]. Players randomly receive their own variance bounded by this. No source on this number.
+	SkillOffsetScale  = 100   //How many games we expect the average player to learn most of the game. Set at 100 due to MMR requiring 100 games (25 per 4 factions) to mature, but anyone's guess.
+	UpsetFactor       = 0.0   //Minimum chance for the lower skilled player to win, up to 0.5. That share of matches is decided by a coin flip regardless of skill, on top of SkillWinWeight.
+	DrawProbability   = 0.0   //Chance a match ends in a draw, before skill is considered. A draw costs both players a game but leaves their streaks and pieces alone.
+	CoinFlipAdvantage = 0.0   //Added to the win chance of whoever goes first, picked by a coin flip each match. Card games usually give going first a small edge, around 0.02.
+	WinCurveSteepness = 1.0   //Scales the skill gap before deciding a match, sharpening (> 1) or flattening (< 1) how much it matters under every WinModel. "logistic" multiplies k by it. At 1 skills are used as is. Should be > 0.0
+	SkillWinWeight    = 0.0   //At zero, weights wins to a/(a+b) where a and b are player skills (i.e. a .9 and .1 player would win against each other 90% and 10% of the time, respectively). At 1, the higher skilled player always wins.
+
+	CurveType = "arctan" //Shape of the learning curve with Learn. "arctan" is the original sigmoid, "logistic" a logistic sigmoid with the same slope at the midpoint, "power" the power law of practice with no skill before the offset.
+
+	SkillDecayPerSeason    = 0.0 //Fraction of a player's experience lost for each season they sit out, with Learn. Moves them back along their learning curve, so rusty veterans come back weaker.
+	IdleSeasonsBeforeDecay = 0   //Seasons in a row a player can sit out before SkillDecayPerSeason applies. At 0 the first idle season already decays.
+
+	SkillDistribution = "uniform" //How new players' max skill is drawn. "uniform" over [0, 1), "normal" from SkillMean and SkillStdDev clamped to [0, 1], "beta" from SkillBetaAlpha and SkillBetaBeta.
+	SkillMean         = 0.5       //Mean of the "normal" skill distribution
+	SkillStdDev       = 0.15      //Standard deviation of the "normal" skill distribution
+	SkillBetaAlpha    = 2.0       //Shape parameters of the "beta" skill distribution. Equal values are symmetric around 0.5, larger values are more bunched up.
+	SkillBetaBeta     = 2.0
+	SkillMin          = 0.0 //Lowest max skill a new player can have. Every distribution is drawn over [0, 1] and then squeezed into [SkillMin, SkillMax], for populations like a tournament where everyone is good.
+	SkillMax          = 1.0 //Highest max skill a new player can have
+
+	SkillGamesCorrelation = 0.0 //Share of new players whose max skill sits as far up the skill band as their games per season do up the games range, so players that play more start out better. New players start with no games played, so games per season stands in for their experience. 0 draws skill and games independently, 1 ties them together.
+
+	SkillDimensions = false //Gives players a second skill component, drawn like the first and learned at the same pace. Each match one player is on the play and the other on the draw, and their skill is a PlayWeight blend of the two components that flips with the role.
+	PlayWeight      = 0.7   //Share of the first component in a player's skill on the play. On the draw it's the second component's share.
+
+	EloK     = 32.0   //Max Elo points a player can gain or lose in one match, with RatingSystem "elo"
+	EloStart = 1500.0 //Elo rating new players start at
+
+	GlickoTau = 0.5 //Glicko-2 system constant, limits how fast volatility can change. Glickman suggests 0.3 to 1.2.
+
+	MMRWeight = 0.02 //How far MMR moves towards the skill a player showed in each match, with RatingSystem "mmr". An exponential moving average, so it takes about 100 games to mature.
+
+	FactionCount     = 1        //Factions each player can queue with. Above 1, every player gets a skill multiplier per faction, so how well they play depends on what they pick. The SkillOffsetScale note assumes the real game's 4.
+	FactionSelection = "random" //"random" picks a faction for each match at random. "best" always picks the player's strongest faction.
+
+	SeasonResetOffset = -1 //Ranks players drop at the start of each season. 0 turns the reset off, -1 drops a tenth of MaxRank, at least 1.
+	SeasonResetFloor  = -1 //Worst rank the reset can drop a player to. Players already past it stay where they are. -1 is MaxRank.
+
+	ContinuousLadder    = false //Never resets ranks between seasons, like ladders that run forever. Players only get their games refilled, whatever SeasonResetOffset says.
+	ResetPiecesOnSeason = false //Zeroes Pieces and Streak when ranks are reset between seasons. Otherwise players carry both into the new season.
+
+	//Procedural changes
+	Debug             = false
+	MatchSearchWidth  = 0     //When > 0, always matches against anyone within this many ranks of the player. 0 only leaves the player's rank when it's otherwise empty, then searches outward.
+	PartyRate         = 0.0   //Fraction of players with games that queue as a party each season. Parties only play parties of the same size, on the average skill of their members.
+	PartySize         = 3     //Largest party. Parties are 2 to PartySize players.
+	QueueExpansion    = 0     //When > 0, a player that can't find a match widens their search by this many ranks and waits, starting from MatchSearchWidth. Failed attempts only count towards FailedMatchMaking once the search covers the ladder.
+	MatchBySkill      = false //Pairs a player with the closest skilled player in their matchmaking pool instead of a random one. Scans the whole pool, so slower on big ranks.
+	MatchByMMR        = false //Pairs a player with the closest MMR of anyone with games, ignoring rank, with RatingSystem "mmr". Scans every player with games, so slow on big populations.
+	FailedMatchMaking = 10    //Matchmaking attempts before a player ragequits the season, mostly to prevent small user pools from infinite loops
+	OutputFormat      = "csv" //"csv" writes the end of season rankings for spreadsheets. "json" writes them as structured data with a season header.
+	LeaderboardSize   = 100   //Top players written to a Leaderboard CSV with their id, rank, games played and rating, on the same rating as the Pro Rank cutoff. 0 turns it off.
+	OutputDir         = ""    //Directory every output file is written to, created if missing. Empty is the working directory.
+
+	ChurnProbability = 0.0 //Base chance a returning player quits for good at the start of a season. Doubles for the least skilled players, and goes up again for ending last season on a losing streak or a ragequit.
+	SmurfRate        = 0.0 //Fraction of new players each season that are experienced players on a fresh account. Smurfs start at MaxRank whatever the newcomer distribution, with a high max skill, already well along their learning curve.
+
+	CalibrationGames    = 0 //Placement games new players play before settling into normal progression. Pieces won and lost count triple until then.
+	CalibrationPriority = 0 //Extra draws the matchmaker takes looking for a player still in placements before settling for whoever it drew, so new players calibrate earlier in the season. 0 draws once, like everyone else.
+
+	EquilibriumTolerance = 0.01 //Largest change in any rank's share of the active players from one season to the next for the ladder to count as settled. The report names the first season under it.
+
+	SampleRate = 1.0 //Fraction of each player's games played as full matches. The rest are resolved after the main loop against the average skill of the player's rank, skipping matchmaking. Faster for huge populations, but deferred games don't move opponents or count towards match stats, so lower rates drift further from a full run.
+
+	StarvationWarnings        = false //Logs when a rank is reduced to zero or one player with games while another rank still has many. Helps diagnose mid-season ragequits.
+	StarvationThreshold       = 10    //Players the largest rank needs for a zero or one player rank to count as starved
+	StarvationWarningInterval = 10000 //Matches to wait before warning about the same rank again
+
+	Progress         = false //Logs matches played and players left every ProgressInterval seconds while a season runs. For long runs on big populations.
+	ProgressInterval = 5     //Seconds between progress logs
+)
+
+var (
+	NewcomerRankDistribution = []float64{} //Fraction of new players starting at each rank, indexed by rank. Doesn't need to sum to 1. Empty starts everyone at MaxRank.
+	RankUpStartingPieces     = []int{}     //Pieces a player starts with after ranking up, indexed by the new rank. Ranks past the end of the list carry over their extra pieces as usual.
+	RankPieces               = []int{}     //Pieces needed to leave each rank, indexed by rank, for ladders that get grindier in some tiers. Ranks past the end of the list use PiecesPerRank.
+)
+
+type Scenario struct {
+	Name string //Also the subdirectory its output is written to
+	Config
+}
+
+type ScenarioResult struct {
+	Name      string
+	Seed      int64
+	Summaries []SeasonSummary
+}
+
+type Config struct {
+	Derank                    bool
+	Learn                     bool
+	InverseLearning           bool
+	InverseLearnFloor         float64
+	CurveType                 string
+	FactionCount              int
+	FactionSelection          string
+	SeasonResetOffset         int
+	SeasonResetFloor          int
+	ContinuousLadder          bool
+	ResetPiecesOnSeason       bool
+	SkillDistribution         string
+	SkillMean                 float64
+	SkillStdDev               float64
+	SkillBetaAlpha            float64
+	SkillBetaBeta             float64
+	SkillMin                  float64
+	SkillMax                  float64
+	SkillGamesCorrelation     float64
+	SkillDimensions           bool
+	PlayWeight                float64
+	GamesPerSeason            int
+	MaxRank                   int
+	ProRankSize               int
+	FixedGamesPerSeason       int
+	RankProgressionMode       string
+	StreakScope               string
+	PiecesPerRank             int
+	StreakThreshold           int
+	StreakBonusPieces         int
+	StreakBonusRank           int
+	FreeLossRank              int
+	LossStreakRank            int
+	NoStreakBonus             bool
+	WinModel                  string
+	MatchFormat               string
+	RatingSystem              string
+	LadderType                string
+	EloK                      float64
+	GlickoTau                 float64
+	MMRWeight                 float64
+	LearnFactor               float64
+	LearnScale                float64
+	PlayersPerSeason          int
+	Seasons                   int
+	SeasonalVariance          int
+	SkillOffsetScale          int
+	UpsetFactor               float64
+	DrawProbability           float64
+	CoinFlipAdvantage         float64
+	WinCurveSteepness         float64
+	SkillWinWeight            float64
+	SkillDecayPerSeason       float64
+	IdleSeasonsBeforeDecay    int
+	Debug                     bool
+	MatchSearchWidth          int
+	PartyRate                 float64
+	PartySize                 int
+	QueueExpansion            int
+	MatchBySkill              bool
+	MatchByMMR                bool
+	FailedMatchMaking         int
+	OutputDir                 string
+	ChurnProbability          float64
+	SmurfRate                 float64
+	CalibrationGames          int
+	CalibrationPriority       int
+	SampleRate                float64
+	EquilibriumTolerance      float64
+	StarvationWarnings        bool
+	StarvationThreshold       int
+	StarvationWarningInterval int
+	Progress                  bool
+	ProgressInterval          int
+	NewcomerRankDistribution  []float64
+	RankUpStartingPieces      []int
+	RankPieces                []int
+	Seed                      int64
+	PerSeasonOutput           bool
+	StreamOutput              bool
+	TransitionMatrix          bool
+	LeaderboardSize           int
+	LeaderboardEverySeason    bool
+	Snapshot                  string
+	TracePlayer               int //Id of a player whose rank changes, season resets and games played are written to a Trace CSV, -1 follows nobody
+	Runs                      int //Independent simulations to run and aggregate. Run i is seeded with Seed+i.
+	Parallel                  int //Goroutines to spread runs over, 0 uses every CPU
+	OutputFormat              string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Derank:                    Derank,
+		Learn:                     Learn,
+		InverseLearning:           InverseLearning,
+		InverseLearnFloor:         InverseLearnFloor,
+		CurveType:                 CurveType,
+		FactionCount:              FactionCount,
+		FactionSelection:          FactionSelection,
+		SeasonResetOffset:         SeasonResetOffset,
+		SeasonResetFloor:          SeasonResetFloor,
+		ContinuousLadder:          ContinuousLadder,
+		ResetPiecesOnSeason:       ResetPiecesOnSeason,
+		SkillDistribution:         SkillDistribution,
+		SkillMean:                 SkillMean,
+		SkillStdDev:               SkillStdDev,
+		SkillBetaAlpha:            SkillBetaAlpha,
+		SkillBetaBeta:             SkillBetaBeta,
+		SkillMin:                  SkillMin,
+		SkillMax:                  SkillMax,
+		SkillGamesCorrelation:     SkillGamesCorrelation,
+		SkillDimensions:           SkillDimensions,
+		PlayWeight:                PlayWeight,
+		GamesPerSeason:            GamesPerSeason,
+		MaxRank:                   MaxRank,
+		ProRankSize:               ProRankSize,
+		FixedGamesPerSeason:       FixedGamesPerSeason,
+		RankProgressionMode:       RankProgressionMode,
+		StreakScope:               StreakScope,
+		PiecesPerRank:             PiecesPerRank,
+		StreakThreshold:           StreakThreshold,
+		StreakBonusPieces:         StreakBonusPieces,
+		StreakBonusRank:           StreakBonusRank,
+		FreeLossRank:              FreeLossRank,
+		LossStreakRank:            LossStreakRank,
+		NoStreakBonus:             NoStreakBonus,
+		WinModel:                  WinModel,
+		MatchFormat:               MatchFormat,
+		RatingSystem:              RatingSystem,
+		LadderType:                LadderType,
+		EloK:                      EloK,
+		GlickoTau:                 GlickoTau,
+		MMRWeight:                 MMRWeight,
+		LearnFactor:               LearnFactor,
+		LearnScale:                LearnScale,
+		PlayersPerSeason:          PlayersPerSeason,
+		Seasons:                   Seasons,
+		SeasonalVariance:          SeasonalVariance,
+		SkillOffsetScale:          SkillOffsetScale,
+		UpsetFactor:               UpsetFactor,
+		DrawProbability:           DrawProbability,
+		CoinFlipAdvantage:         CoinFlipAdvantage,
+		WinCurveSteepness:         WinCurveSteepness,
+		SkillWinWeight:            SkillWinWeight,
+		SkillDecayPerSeason:       SkillDecayPerSeason,
+		IdleSeasonsBeforeDecay:    IdleSeasonsBeforeDecay,
+		Debug:                     Debug,
+		MatchSearchWidth:          MatchSearchWidth,
+		PartyRate:                 PartyRate,
+		PartySize:                 PartySize,
+		QueueExpansion:            QueueExpansion,
+		MatchBySkill:              MatchBySkill,
+		MatchByMMR:                MatchByMMR,
+		FailedMatchMaking:         FailedMatchMaking,
+		OutputDir:                 OutputDir,
+		ChurnProbability:          ChurnProbability,
+		SmurfRate:                 SmurfRate,
+		CalibrationGames:          CalibrationGames,
+		CalibrationPriority:       CalibrationPriority,
+		SampleRate:                SampleRate,
+		EquilibriumTolerance:      EquilibriumTolerance,
+		StarvationWarnings:        StarvationWarnings,
+		StarvationThreshold:       StarvationThreshold,
+		StarvationWarningInterval: StarvationWarningInterval,
+		Progress:                  Progress,
+		ProgressInterval:          ProgressInterval,
+		NewcomerRankDistribution:  NewcomerRankDistribution,
+		RankUpStartingPieces:      RankUpStartingPieces,
+		RankPieces:                RankPieces,
+		OutputFormat:              OutputFormat,
+		LeaderboardSize:           LeaderboardSize,
+		Runs:                      1,
+		TracePlayer:               -1,
+	}
+}
+
+func LoadConfig(path string) (Config, error) {
+	//Anything the file leaves out keeps its default
+	config := DefaultConfig()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (config *Config) Validate() error {
+	//A player's learning rate is SkillOffsetScale * LearnFactor / (1 + rand*(LearnScale-1)), all three have to be positive for it to be
+	if config.LearnScale <= 0.0 {
+		return fmt.Errorf("LearnScale must be > 0.0, got %v", config.LearnScale)
+	}
+	if config.LearnFactor <= 0.0 {
+		return fmt.Errorf("LearnFactor must be > 0.0, got %v", config.LearnFactor)
+	}
+	if config.SkillOffsetScale <= 0 {
+		return fmt.Errorf("SkillOffsetScale must be > 0, got %v", config.SkillOffsetScale)
+	}
+	if config.WinCurveSteepness <= 0.0 {
+		return fmt.Errorf("WinCurveSteepness must be > 0.0, got %v", config.WinCurveSteepness)
+	}
+	if config.SkillWinWeight < 0.0 || config.SkillWinWeight > 1.0 {
+		return fmt.Errorf("SkillWinWeight must be between 0.0 and 1.0, got %v", config.SkillWinWeight)
+	}
+	if config.UpsetFactor < 0.0 || config.UpsetFactor > 0.5 {
+		return fmt.Errorf("UpsetFactor must be between 0.0 and 0.5, got %v", config.UpsetFactor)
+	}
+	if config.SkillDecayPerSeason < 0.0 || config.SkillDecayPerSeason > 1.0 {
+		return fmt.Errorf("SkillDecayPerSeason must be between 0.0 and 1.0, got %v", config.SkillDecayPerSeason)
+	}
+	if config.IdleSeasonsBeforeDecay < 0 {
+		return fmt.Errorf("IdleSeasonsBeforeDecay can't be negative, got %v", config.IdleSeasonsBeforeDecay)
+	}
+	if config.DrawProbability < 0.0 || config.DrawProbability >= 1.0 {
+		return fmt.Errorf("DrawProbability must be >= 0.0 and < 1.0, got %v", config.DrawProbability)
+	}
+	if config.Runs < 1 || config.Parallel < 0 {
+		return fmt.Errorf("Runs must be at least 1 and Parallel can't be negative")
+	}
+	if config.ChurnProbability < 0.0 || config.ChurnProbability > 1.0 {
+		return fmt.Errorf("ChurnProbability must be between 0.0 and 1.0, got %v", config.ChurnProbability)
+	}
+	if config.SmurfRate < 0.0 || config.SmurfRate > 1.0 {
+		return fmt.Errorf("SmurfRate must be between 0.0 and 1.0, got %v", config.SmurfRate)
+	}
+	if config.CalibrationGames < 0 {
+		return fmt.Errorf("CalibrationGames must be >= 0, got %v", config.CalibrationGames)
+	}
+	if config.CalibrationPriority < 0 {
+		return fmt.Errorf("CalibrationPriority must be >= 0, got %v", config.CalibrationPriority)
+	}
+	if config.PartyRate < 0.0 || config.PartyRate > 1.0 {
+		return fmt.Errorf("PartyRate must be between 0.0 and 1.0, got %v", config.PartyRate)
+	}
+	if config.PartySize < 2 {
+		return fmt.Errorf("PartySize must be at least 2, got %d", config.PartySize)
+	}
+	if config.EquilibriumTolerance <= 0.0 {
+		return fmt.Errorf("EquilibriumTolerance must be > 0.0, got %v", config.EquilibriumTolerance)
+	}
+	if config.SampleRate <= 0.0 || config.SampleRate > 1.0 {
+		return fmt.Errorf("SampleRate must be > 0.0 and <= 1.0, got %v", config.SampleRate)
+	}
+	if config.Seasons < 0 || config.PlayersPerSeason < 0 || config.GamesPerSeason < 0 || config.SeasonalVariance < 0 || config.FixedGamesPerSeason < 0 || config.MatchSearchWidth < 0 || config.QueueExpansion < 0 || config.FailedMatchMaking < 0 {
+		return fmt.Errorf("Seasons, PlayersPerSeason, GamesPerSeason, SeasonalVariance, FixedGamesPerSeason, MatchSearchWidth, QueueExpansion and FailedMatchMaking can't be negative")
+	}
+	if config.MaxRank < 1 {
+		return fmt.Errorf("MaxRank must be at least 1, got %d", config.MaxRank)
+	}
+	if config.ProRankSize < 1 {
+		return fmt.Errorf("ProRankSize must be at least 1, got %d", config.ProRankSize)
+	}
+	if len(config.NewcomerRankDistribution) > config.MaxRank+1 {
+		return fmt.Errorf("NewcomerRankDistribution has %d entries, but there are only %d ranks", len(config.NewcomerRankDistribution), config.MaxRank+1)
+	}
+	newcomerTotal := 0.0
+	for r := 0; r < len(config.NewcomerRankDistribution); r++ {
+		if config.NewcomerRankDistribution[r] < 0 {
+			return fmt.Errorf("NewcomerRankDistribution can't be negative, got %v at rank %d", config.NewcomerRankDistribution[r], r)
+		}
+		newcomerTotal += config.NewcomerRankDistribution[r]
+	}
+	//Leave it empty to start everyone at MaxRank, a list of zeros is more likely a mistake
+	if len(config.NewcomerRankDistribution) > 0 && newcomerTotal == 0 {
+		return fmt.Errorf("NewcomerRankDistribution needs a fraction above 0 at some rank, or to be empty")
+	}
+	if len(config.RankUpStartingPieces) > config.MaxRank+1 {
+		return fmt.Errorf("RankUpStartingPieces has %d entries, but there are only %d ranks", len(config.RankUpStartingPieces), config.MaxRank+1)
+	}
+	for r := 0; r < len(config.RankUpStartingPieces); r++ {
+		if config.RankUpStartingPieces[r] < 0 {
+			return fmt.Errorf("RankUpStartingPieces can't be negative, got %v at rank %d", config.RankUpStartingPieces[r], r)
+		}
+	}
+	if len(config.RankPieces) > config.MaxRank+1 {
+		return fmt.Errorf("RankPieces has %d entries, but there are only %d ranks", len(config.RankPieces), config.MaxRank+1)
+	}
+	for r := 0; r < len(config.RankPieces); r++ {
+		if config.RankPieces[r] < 1 {
+			return fmt.Errorf("RankPieces must be >= 1, got %v at rank %d", config.RankPieces[r], r)
+		}
+	}
+	if config.RankProgressionMode != "full" && config.RankProgressionMode != "summary" {
+		return fmt.Errorf("RankProgressionMode must be \"full\" or \"summary\", got %q", config.RankProgressionMode)
+	}
+	if config.StreakScope != "global" && config.StreakScope != "perRank" {
+		return fmt.Errorf("StreakScope must be \"global\" or \"perRank\", got %q", config.StreakScope)
+	}
+	if config.PiecesPerRank < 1 {
+		return fmt.Errorf("PiecesPerRank must be >= 1, got %v", config.PiecesPerRank)
+	}
+	if config.StreakThreshold < 1 {
+		return fmt.Errorf("StreakThreshold must be >= 1, got %v", config.StreakThreshold)
+	}
+	if config.StreakBonusPieces < 1 {
+		return fmt.Errorf("StreakBonusPieces must be >= 1, got %v", config.StreakBonusPieces)
+	}
+	if config.FreeLossRank < 0 || config.FreeLossRank > config.MaxRank {
+		return fmt.Errorf("FreeLossRank must be between 0 and MaxRank %d, got %v", config.MaxRank, config.FreeLossRank)
+	}
+	if config.LossStreakRank < 0 || config.LossStreakRank > config.MaxRank {
+		return fmt.Errorf("LossStreakRank must be between 0 and MaxRank %d, got %v", config.MaxRank, config.LossStreakRank)
+	}
+	if config.LossStreakRank > config.FreeLossRank {
+		return fmt.Errorf("LossStreakRank must be <= FreeLossRank, got %v and %v", config.LossStreakRank, config.FreeLossRank)
+	}
+	if config.WinModel != "linear" && config.WinModel != "bradleyterry" && config.WinModel != "logistic" {
+		return fmt.Errorf("WinModel must be \"linear\", \"bradleyterry\" or \"logistic\", got %q", config.WinModel)
+	}
+	if config.MatchFormat != "single" && config.MatchFormat != "bo3" {
+		return fmt.Errorf("MatchFormat must be \"single\" or \"bo3\", got %q", config.MatchFormat)
+	}
+	if config.LadderType != "pieces" && config.LadderType != "simple" {
+		return fmt.Errorf("LadderType must be \"pieces\" or \"simple\", got %q", config.LadderType)
+	}
+	if config.RatingSystem != "pieces" && config.RatingSystem != "elo" && config.RatingSystem != "glicko" && config.RatingSystem != "mmr" {
+		return fmt.Errorf("RatingSystem must be \"pieces\", \"elo\", \"glicko\" or \"mmr\", got %q", config.RatingSystem)
+	}
+	if config.MMRWeight <= 0.0 || config.MMRWeight > 1.0 {
+		return fmt.Errorf("MMRWeight must be in (0, 1], got %v", config.MMRWeight)
+	}
+	if config.MatchByMMR && config.RatingSystem != "mmr" {
+		return fmt.Errorf("MatchByMMR needs RatingSystem \"mmr\", got %q", config.RatingSystem)
+	}
+	if config.GlickoTau <= 0.0 {
+		return fmt.Errorf("GlickoTau must be > 0.0, got %v", config.GlickoTau)
+	}
+	if config.CurveType != "arctan" && config.CurveType != "logistic" && config.CurveType != "power" {
+		return fmt.Errorf("CurveType must be \"arctan\", \"logistic\" or \"power\", got %q", config.CurveType)
+	}
+	if config.FactionCount < 1 {
+		return fmt.Errorf("FactionCount must be >= 1, got %v", config.FactionCount)
+	}
+	if config.FactionSelection != "random" && config.FactionSelection != "best" {
+		return fmt.Errorf("FactionSelection must be \"random\" or \"best\", got %q", config.FactionSelection)
+	}
+	if config.SeasonResetOffset < -1 {
+		return fmt.Errorf("SeasonResetOffset must be >= -1, got %v", config.SeasonResetOffset)
+	}
+	if config.SeasonResetFloor < -1 || config.SeasonResetFloor > config.MaxRank {
+		return fmt.Errorf("SeasonResetFloor must be between -1 and MaxRank, got %v", config.SeasonResetFloor)
+	}
+	if config.ProgressInterval < 1 {
+		return fmt.Errorf("ProgressInterval must be >= 1, got %v", config.ProgressInterval)
+	}
+	if config.SkillDistribution != "uniform" && config.SkillDistribution != "normal" && config.SkillDistribution != "beta" {
+		return fmt.Errorf("SkillDistribution must be \"uniform\", \"normal\" or \"beta\", got %q", config.SkillDistribution)
+	}
+	if config.SkillStdDev <= 0.0 {
+		return fmt.Errorf("SkillStdDev must be > 0.0, got %v", config.SkillStdDev)
+	}
+	if config.SkillBetaAlpha <= 0.0 || config.SkillBetaBeta <= 0.0 {
+		return fmt.Errorf("SkillBetaAlpha and SkillBetaBeta must be > 0.0, got %v and %v", config.SkillBetaAlpha, config.SkillBetaBeta)
+	}
+	if config.SkillMin < 0.0 || config.SkillMax > 1.0 || config.SkillMin >= config.SkillMax {
+		return fmt.Errorf("SkillMin and SkillMax must satisfy 0.0 <= SkillMin < SkillMax <= 1.0, got %v and %v", config.SkillMin, config.SkillMax)
+	}
+	if config.SkillGamesCorrelation < 0.0 || config.SkillGamesCorrelation > 1.0 {
+		return fmt.Errorf("SkillGamesCorrelation must be between 0.0 and 1.0, got %v", config.SkillGamesCorrelation)
+	}
+	if config.CoinFlipAdvantage < 0.0 || config.CoinFlipAdvantage > 0.5 {
+		return fmt.Errorf("CoinFlipAdvantage must be between 0.0 and 0.5, got %v", config.CoinFlipAdvantage)
+	}
+	if config.PlayWeight < 0.0 || config.PlayWeight > 1.0 {
+		return fmt.Errorf("PlayWeight must be between 0.0 and 1.0, got %v", config.PlayWeight)
+	}
+	if config.OutputFormat != "csv" && config.OutputFormat != "json" {
+		return fmt.Errorf("OutputFormat must be \"csv\" or \"json\", got %q", config.OutputFormat)
+	}
+	if config.LeaderboardSize < 0 {
+		return fmt.Errorf("LeaderboardSize can't be negative, got %d", config.LeaderboardSize)
+	}
+	if config.Snapshot != "" && config.Runs > 1 {
+		return fmt.Errorf("Snapshot saves a single simulation, it can't be used with Runs %v", config.Runs)
+	}
+	if config.TracePlayer < -1 {
+		return fmt.Errorf("TracePlayer must be a player id or -1, got %v", config.TracePlayer)
+	}
+	if config.TracePlayer >= 0 && config.Runs > 1 {
+		return fmt.Errorf("TracePlayer follows a player through a single simulation, it can't be used with Runs %v", config.Runs)
+	}
+	if config.StreamOutput && (config.OutputFormat != "csv" || config.PerSeasonOutput) {
+		return fmt.Errorf("StreamOutput only writes a single CSV, it can't be used with OutputFormat %q or PerSeasonOutput", config.OutputFormat)
+	}
+
+	return nil
+}
+
+func (config *Config) RegisterFlags(flags *flag.FlagSet) {
+	//Flag help mirrors the comments on the defaults above
+	flags.BoolVar(&config.Derank, "derank", config.Derank, "Allows players to de-rank on losses. Currently disabled in the game, but was part of older ranking systems.")
+	flags.BoolVar(&config.Learn, "learn", config.Learn, "Allows players to learn as they play more games.")
+	flags.BoolVar(&config.InverseLearning, "inverse-learning", config.InverseLearning, "If players lose skill for every game played, with -learn. Non-real world.")
+	flags.Float64Var(&config.InverseLearnFloor, "inverse-learn-floor", config.InverseLearnFloor, "Minimum skill a player can fall to with -inverse-learning, capped at their max skill.")
+	flags.StringVar(&config.CurveType, "curve-type", config.CurveType, "Shape of the learning curve with -learn. \"arctan\" is the original sigmoid, \"logistic\" a logistic sigmoid with the same slope at the midpoint, \"power\" the power law of practice with no skill before the offset.")
+	flags.StringVar(&config.SkillDistribution, "skill-distribution", config.SkillDistribution, "How new players' max skill is drawn. \"uniform\" over [0, 1), \"normal\" from -skill-mean and -skill-stddev clamped to [0, 1], \"beta\" from -skill-beta-alpha and -skill-beta-beta.")
+	flags.Float64Var(&config.SkillMean, "skill-mean", config.SkillMean, "Mean of the \"normal\" skill distribution.")
+	flags.Float64Var(&config.SkillStdDev, "skill-stddev", config.SkillStdDev, "Standard deviation of the \"normal\" skill distribution.")
+	flags.Float64Var(&config.SkillBetaAlpha, "skill-beta-alpha", config.SkillBetaAlpha, "Alpha shape parameter of the \"beta\" skill distribution.")
+	flags.Float64Var(&config.SkillBetaBeta, "skill-beta-beta", config.SkillBetaBeta, "Beta shape parameter of the \"beta\" skill distribution.")
+	flags.Float64Var(&config.SkillMin, "skill-min", config.SkillMin, "Lowest max skill a new player can have. Every distribution is drawn over [0, 1] and then squeezed into [-skill-min, -skill-max].")
+	flags.Float64Var(&config.SkillMax, "skill-max", config.SkillMax, "Highest max skill a new player can have.")
+	flags.Float64Var(&config.SkillGamesCorrelation, "skill-games-correlation", config.SkillGamesCorrelation, "Share of new players whose max skill sits as far up the skill band as their games per season do up the games range, so players that play more start out better. New players start with no games played, so games per season stands in for their experience. 0 draws skill and games independently, 1 ties them together.")
+	flags.BoolVar(&config.SkillDimensions, "skill-dimensions", config.SkillDimensions, "Gives players a second skill component. Each match one player is on the play and the other on the draw, and their skill is a -play-weight blend of the two components that flips with the role.")
+	flags.Float64Var(&config.PlayWeight, "play-weight", config.PlayWeight, "Share of the first skill component on the play. On the draw it's the second component's share.")
+	flags.IntVar(&config.GamesPerSeason, "games-per-season", config.GamesPerSeason, "Max (+ seasonal-variance/2), average will be half this.")
+	flags.IntVar(&config.MaxRank, "max-rank", config.MaxRank, "Rank new players start at, counting down to Pro Rank at 0. By default the season reset drops players a tenth of this.")
+	flags.IntVar(&config.ProRankSize, "pro-rank-size", config.ProRankSize, "Size of the Pro Rank leaderboard. Pro players rated inside it skip the season and keep their rank, the rest play on.")
+	flags.IntVar(&config.FixedGamesPerSeason, "fixed-games-per-season", config.FixedGamesPerSeason, "When > 0, every player gets exactly this many games each season instead of the variance based draw.")
+	flags.StringVar(&config.RankProgressionMode, "rank-progression-mode", config.RankProgressionMode, "\"full\" keeps a rank progression entry for every rank reached. \"summary\" keeps only the most recent entry, bounding memory at the cost of the GamesToProgressPastRank history.")
+	flags.StringVar(&config.StreakScope, "streak-scope", config.StreakScope, "\"global\" carries win/loss streaks across rank changes. \"perRank\" resets the streak whenever a player changes rank.")
+	flags.IntVar(&config.PiecesPerRank, "pieces-per-rank", config.PiecesPerRank, "A player needs more than this many pieces to leave a rank. Ranking up keeps whatever is left over, and a derank starts the lower rank with this many.")
+	flags.IntVar(&config.StreakThreshold, "streak-threshold", config.StreakThreshold, "Wins in a row a player needs before wins earn -streak-bonus-pieces.")
+	flags.IntVar(&config.StreakBonusPieces, "streak-bonus-pieces", config.StreakBonusPieces, "Pieces for a win on a streak, instead of 1.")
+	flags.IntVar(&config.StreakBonusRank, "streak-bonus-rank", config.StreakBonusRank, "The streak bonus only applies above this rank.")
+	flags.IntVar(&config.FreeLossRank, "free-loss-rank", config.FreeLossRank, "Losses above this rank never cost a piece.")
+	flags.IntVar(&config.LossStreakRank, "loss-streak-rank", config.LossStreakRank, "Above this rank, up to -free-loss-rank, only the second loss in a row onwards costs a piece. At or below it every loss does.")
+	flags.BoolVar(&config.NoStreakBonus, "no-streak-bonus", config.NoStreakBonus, "Every win is worth one piece, streak or not. Streaks are still counted for loss protection.")
+	flags.StringVar(&config.WinModel, "win-model", config.WinModel, "\"linear\" rolls the match against the skill-win-weight blend. \"bradleyterry\" has a beat b with probability a/(a+b) exactly. \"logistic\" has a beat b with probability 1/(1+exp(-k*(a-b))), k growing with skill-win-weight.")
+	flags.StringVar(&config.WinModel, "outcome-model", config.WinModel, "Same as -win-model.")
+	flags.StringVar(&config.MatchFormat, "match-format", config.MatchFormat, "\"single\" decides a match with one game. \"bo3\" plays rounds until someone wins two, each round decided like a single game.")
+	flags.StringVar(&config.RatingSystem, "rating-system", config.RatingSystem, "\"pieces\" only runs the ladder. \"elo\" also keeps a classic Elo rating per player, updated from every match, to compare against the ladder. \"glicko\" keeps a Glicko-2 rating instead, with one season as the rating period. \"mmr\" keeps a hidden MMR that follows each player's skill.")
+	flags.StringVar(&config.LadderType, "ladder-type", config.LadderType, "Rank system the ladder runs on. \"pieces\" is the game's piece and streak ladder. \"simple\" moves up a rank for every win and down one for every loss.")
+	flags.Float64Var(&config.EloK, "elo-k", config.EloK, "Max Elo points a player can gain or lose in one match")
+	flags.Float64Var(&config.GlickoTau, "glicko-tau", config.GlickoTau, "Glicko-2 system constant, limits how fast volatility can change. Glickman suggests 0.3 to 1.2.")
+	flags.Float64Var(&config.MMRWeight, "mmr-weight", config.MMRWeight, "How far MMR moves towards the skill a player showed in each match, with -rating-system mmr.")
+	flags.IntVar(&config.FactionCount, "faction-count", config.FactionCount, "Factions each player can queue with. Above 1, every player gets a skill multiplier per faction.")
+	flags.StringVar(&config.FactionSelection, "faction-selection", config.FactionSelection, "\"random\" picks a faction for each match at random. \"best\" always picks the player's strongest faction.")
+	flags.IntVar(&config.SeasonResetOffset, "season-reset-offset", config.SeasonResetOffset, "Ranks players drop at the start of each season. 0 turns the reset off, -1 drops a tenth of max-rank, at least 1.")
+	flags.IntVar(&config.SeasonResetFloor, "season-reset-floor", config.SeasonResetFloor, "Worst rank the reset can drop a player to. Players already past it stay where they are. -1 is max-rank.")
+	flags.BoolVar(&config.ContinuousLadder, "continuous-ladder", config.ContinuousLadder, "Never resets ranks between seasons. Players only get their games refilled.")
+	flags.BoolVar(&config.ResetPiecesOnSeason, "reset-pieces-on-season", config.ResetPiecesOnSeason, "Zeroes pieces and streaks when ranks are reset between seasons.")
+	flags.Float64Var(&config.LearnFactor, "learn-factor", config.LearnFactor, "Affects all players. Alters slope of sigmoid by same rate for all players. Larger increases learning speed, but also increases the \"just don't get it\" factor for struggling players.")
+	flags.Float64Var(&config.LearnScale, "learn-scale", config.LearnScale, "Allows some players to learn faster than others. Alters slope of sigmoid by different rates. Should be > 0.0")
+	flags.IntVar(&config.PlayersPerSeason, "players-per-season", config.PlayersPerSeason, "Number of new players added each season.")
+	flags.IntVar(&config.Seasons, "seasons", config.Seasons, "Number of seasons in which to run the simulation.")
+	flags.IntVar(&config.SeasonalVariance, "seasonal-variance", config.SeasonalVariance, "The change in maximum number of games played between seasons for players. Range is set at [-SV/2, SV/2]. Players randomly receive their own variance bounded by this.")
+	flags.IntVar(&config.SkillOffsetScale, "skill-offset-scale", config.SkillOffsetScale, "How many games we expect the average player to learn most of the game.")
+	flags.Float64Var(&config.UpsetFactor, "upset-factor", config.UpsetFactor, "Minimum chance for the lower skilled player to win, up to 0.5. That share of matches is decided by a coin flip regardless of skill.")
+	flags.Float64Var(&config.DrawProbability, "draw-probability", config.DrawProbability, "Chance a match ends in a draw, before skill is considered. A draw costs both players a game but leaves their streaks and pieces alone.")
+	flags.Float64Var(&config.CoinFlipAdvantage, "coin-flip-advantage", config.CoinFlipAdvantage, "Added to the win chance of whoever goes first, picked by a coin flip each match.")
+	flags.Float64Var(&config.WinCurveSteepness, "win-curve-steepness", config.WinCurveSteepness, "Scales the skill gap before deciding a match, sharpening (> 1) or flattening (< 1) how much it matters under every -win-model. \"logistic\" multiplies k by it. Should be > 0.0")
+	flags.Float64Var(&config.SkillWinWeight, "skill-win-weight", config.SkillWinWeight, "At zero, weights wins to a/(a+b) where a and b are player skills. At 1, the higher skilled player always wins.")
+	flags.Float64Var(&config.SkillDecayPerSeason, "skill-decay-per-season", config.SkillDecayPerSeason, "Fraction of a player's experience lost for each season they sit out, with Learn. Moves them back along their learning curve, so rusty veterans come back weaker.")
+	flags.IntVar(&config.IdleSeasonsBeforeDecay, "idle-seasons-before-decay", config.IdleSeasonsBeforeDecay, "Seasons in a row a player can sit out before skill-decay-per-season applies. At 0 the first idle season already decays.")
+	flags.BoolVar(&config.Debug, "debug", config.Debug, "Logs matchmaking details and checks rank buckets after every match. Very slow.")
+	flags.IntVar(&config.MatchSearchWidth, "match-search-width", config.MatchSearchWidth, "When > 0, always matches against anyone within this many ranks of the player. 0 only leaves the player's rank when it's otherwise empty, then searches outward.")
+	flags.Float64Var(&config.PartyRate, "party-rate", config.PartyRate, "Fraction of players with games that queue as a party each season. Parties only play parties of the same size, on the average skill of their members.")
+	flags.IntVar(&config.PartySize, "party-size", config.PartySize, "Largest party. Parties are 2 to party-size players.")
+	flags.IntVar(&config.QueueExpansion, "queue-expansion", config.QueueExpansion, "When > 0, a player that can't find a match widens their search by this many ranks and waits, starting from match-search-width. Failed attempts only count towards failed-matchmaking once the search covers the ladder.")
+	flags.BoolVar(&config.MatchBySkill, "match-by-skill", config.MatchBySkill, "Pairs a player with the closest skilled player in their matchmaking pool instead of a random one. Scans the whole pool, so slower on big ranks.")
+	flags.BoolVar(&config.MatchByMMR, "match-by-mmr", config.MatchByMMR, "Pairs a player with the closest MMR of anyone with games, ignoring rank, with -rating-system mmr. Scans every player with games, so slow on big populations.")
+	flags.IntVar(&config.FailedMatchMaking, "failed-matchmaking", config.FailedMatchMaking, "Matchmaking attempts before a player ragequits the season, mostly to prevent small user pools from infinite loops")
+	flags.StringVar(&config.OutputDir, "output-dir", config.OutputDir, "Directory every output file is written to, created if missing. Empty is the working directory.")
+	flags.Float64Var(&config.ChurnProbability, "churn-probability", config.ChurnProbability, "Base chance a returning player quits for good at the start of a season. Doubles for the least skilled players, and goes up again for ending last season on a losing streak or a ragequit.")
+	flags.Float64Var(&config.SmurfRate, "smurf-rate", config.SmurfRate, "Fraction of new players each season that are experienced players on a fresh account. Smurfs start at -max-rank with a high max skill.")
+	flags.IntVar(&config.CalibrationGames, "calibration-games", config.CalibrationGames, "Placement games new players play before settling into normal progression. Pieces won and lost count triple until then.")
+	flags.IntVar(&config.CalibrationPriority, "calibration-priority", config.CalibrationPriority, "Extra draws the matchmaker takes looking for a player still in placements before settling for whoever it drew, so new players calibrate earlier in the season. 0 draws once, like everyone else.")
+	flags.Float64Var(&config.EquilibriumTolerance, "equilibrium-tolerance", config.EquilibriumTolerance, "Largest change in any rank's share of the active players from one season to the next for the ladder to count as settled. The report names the first season under it.")
+	flags.Float64Var(&config.SampleRate, "sample-rate", config.SampleRate, "Fraction of each player's games played as full matches. The rest are resolved against the average skill of the player's rank, skipping matchmaking. Faster, but less accurate the lower it goes.")
+	flags.BoolVar(&config.StarvationWarnings, "starvation-warnings", config.StarvationWarnings, "Logs when a rank is reduced to zero or one player with games while another rank still has many.")
+	flags.IntVar(&config.StarvationThreshold, "starvation-threshold", config.StarvationThreshold, "Players the largest rank needs for a zero or one player rank to count as starved")
+	flags.IntVar(&config.StarvationWarningInterval, "starvation-warning-interval", config.StarvationWarningInterval, "Matches to wait before warning about the same rank again")
+	flags.BoolVar(&config.Progress, "progress", config.Progress, "Logs matches played and players left every -progress-interval seconds while a season runs.")
+	flags.IntVar(&config.ProgressInterval, "progress-interval", config.ProgressInterval, "Seconds between -progress logs.")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "Seed for the random number generator, for reproducible runs. 0 picks one from the clock, which is logged so the run can be replayed.")
+	flags.BoolVar(&config.PerSeasonOutput, "per-season-output", config.PerSeasonOutput, "Writes a file per season, suffixed with the season number, instead of overwriting one file.")
+	flags.BoolVar(&config.StreamOutput, "stream-output", config.StreamOutput, "Writes every season to one CSV with a season column, flushed as each season ends, so a crash keeps the seasons already played.")
+	flags.BoolVar(&config.TransitionMatrix, "transition-matrix", config.TransitionMatrix, "Also writes a grid of how many players went from each rank after the season reset to each rank at season end, to a Transitions CSV.")
+	flags.IntVar(&config.LeaderboardSize, "leaderboard-size", config.LeaderboardSize, "Top players written to a Leaderboard CSV with their id, rank, games played and rating, on the same rating as the Pro Rank cutoff. 0 turns it off.")
+	flags.BoolVar(&config.LeaderboardEverySeason, "leaderboard-every-season", config.LeaderboardEverySeason, "Writes a leaderboard per season, suffixed with the season number, instead of one after the final season.")
+	flags.StringVar(&config.Snapshot, "snapshot", config.Snapshot, "Saves every player, the next season, the seed and the generator state to this file after each season, to pick the run back up with -resume.")
+	flags.IntVar(&config.TracePlayer, "trace-player", config.TracePlayer, "Id of a player to follow through the whole run. Their rank changes, season resets and games played are written as a timeline to a Trace CSV. -1 follows nobody.")
+	flags.IntVar(&config.Runs, "runs", config.Runs, "Independent simulations to run. Above 1, only the final season's rankings are kept, aggregated into a mean and 95% confidence interval per rank. Run i is seeded with seed+i.")
+	flags.IntVar(&config.Parallel, "parallel", config.Parallel, "Goroutines to spread runs over, 0 uses every CPU.")
+	flags.StringVar(&config.OutputFormat, "format", config.OutputFormat, "\"csv\" writes the end of season rankings for spreadsheets. \"json\" writes them as structured data with a season header.")
+	flags.Func("newcomer-rank-distribution", "Comma separated fraction of new players starting at each rank, indexed by rank. Empty starts everyone at max-rank.", func(value string) error {
+		distribution, err := parseFloats(value)
+		config.NewcomerRankDistribution = distribution
+		return err
+	})
+	flags.Func("rank-up-starting-pieces", "Comma separated pieces a player starts with after ranking up, indexed by the new rank. Ranks past the end of the list carry over their extra pieces.", func(value string) error {
+		pieces, err := parseInts(value)
+		config.RankUpStartingPieces = pieces
+		return err
+	})
+	flags.Func("rank-pieces", "Comma separated pieces needed to leave each rank, indexed by rank. Ranks past the end of the list use -pieces-per-rank.", func(value string) error {
+		pieces, err := parseInts(value)
+		config.RankPieces = pieces
+		return err
+	})
+}
+
+func parseFloats(value string) ([]float64, error) {
+	list := make([]float64, 0)
+	if value == "" {
+		return list, nil
+	}
+	fields := strings.Split(value, ",")
+	for i := 0; i < len(fields); i++ {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, parsed)
+	}
+
+	return list, nil
+}
+
+func parseInts(value string) ([]int, error) {
+	list := make([]int, 0)
+	if value == "" {
+		return list, nil
+	}
+	fields := strings.Split(value, ",")
+	for i := 0; i < len(fields); i++ {
+		parsed, err := strconv.Atoi(strings.TrimSpace(fields[i]))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, parsed)
+	}
+
+	return list, nil
+}
+
+type Player struct {
+	Id                int
+	Rank              int
+	Streak            int
+	Pieces            int
+	GamesLeft         int
+	GamesPlayed       int
+	GamesPerSeason    int
+	SeasonalVariance  int
+	FailedMatchMaking int
+	Party             int //Index into the season's parties, -1 when queueing solo
+	QueueTime         int //Matchmaking attempts spent waiting for the current match, see QueueExpansion
+	PiecesEarned      int
+	PiecesLost        int
+	Wins              int //Matches won over the whole run
+	Losses            int
+	Draws             int
+	EloRating         float64 //Only updated with RatingSystem "elo"
+	Glicko            Glicko  //Only updated with RatingSystem "glicko"
+	MMR               float64 //Hidden rating, only updated with RatingSystem "mmr"
+	LastSeasonRank    int     //Rank at the end of the previous season, -1 if the player is new this season
+	DeferredGames     int     //Games this season resolved outside of matchmaking, see SampleRate
+	IdleSeasons       int     //Seasons in a row drawn without games, see IdleSeasonsBeforeDecay
+	JoinedSeason      int
+	Retired           bool //Churned out of the game, see ChurnProbability. Retired players never get games again.
+	Smurf             bool //Experienced player on a new account, see SmurfRate
+	Calibrating       bool //Still playing placement games, see CalibrationGames
+	PlacementRank     int  //Rank when calibration finished
+	PlacementSeason   int  //Season calibration finished in
+	Season            int  //Season currently being played
+	RankProgression   []RankProgression
+	Skill             Skill
+	Factions          []float64 //Skill multiplier for each faction, nil with a single faction
+}
+
+type RankProgression struct {
+	Rank        int
+	GamesPlayed int
+	Season      int
+}
+
+type SeasonStats struct {
+	ActivePlayers int
+
+	//Per rank metrics from the matches played this season, indexed by player a's rank at match time
+	FavoriteWins    []int   //Matches won by the higher skilled player
+	FavoriteMatches []int   //Matches between players of different skill
+	NewcomerWins    []int   //Matches won by the first season player against a veteran
+	NewcomerMatches []int   //Matches between a first season player and a veteran
+	QueueTimes      [][]int //Each player's QueueTime when they got a match, indexed by their own rank. Only with QueueExpansion.
+	Ragequits       []int   //Players that gave up on the season after FailedMatchMaking failed attempts, indexed by their rank when they quit
+
+	SkillGaps [][]float64 //Skill difference between the two players of every match, indexed by player a's rank at match time
+
+	//Over every match with a player going first. Only with CoinFlipAdvantage or SkillDimensions.
+	FirstPlayerWins    int
+	FirstPlayerMatches int //Draws aren't counted
+
+	//Indexed by rank at the end of the previous season
+	LastSeasonPlayers []int //Players that finished last season at this rank
+	Retained          []int //Of those, players that have games this season
+	Churned           []int //Of those, players that retired at the start of this season
+
+	ResetRanks []int //Returning players by their rank after the season reset. Pro Rank leaderboard players skip the reset.
+
+	Transitions [][]int //Players by rank after the season reset, then by rank at the end of the season. Only with TransitionMatrix.
+
+	//Indexed by faction. Only with FactionCount > 1.
+	FactionWins    []int //Matches won while playing this faction
+	FactionMatches []int //Matches played with this faction, twice for mirror matches. Draws aren't counted.
+}
+
+func NewSeasonStats(config *Config) *SeasonStats {
+	stats := SeasonStats{}
+	stats.FavoriteWins = make([]int, config.MaxRank+1)
+	stats.FavoriteMatches = make([]int, config.MaxRank+1)
+	stats.NewcomerWins = make([]int, config.MaxRank+1)
+	stats.NewcomerMatches = make([]int, config.MaxRank+1)
+	stats.LastSeasonPlayers = make([]int, config.MaxRank+1)
+	stats.Retained = make([]int, config.MaxRank+1)
+	stats.Churned = make([]int, config.MaxRank+1)
+	stats.ResetRanks = make([]int, config.MaxRank+1)
+	stats.QueueTimes = make([][]int, config.MaxRank+1)
+	stats.Ragequits = make([]int, config.MaxRank+1)
+	stats.SkillGaps = make([][]float64, config.MaxRank+1)
+	stats.Transitions = make([][]int, 0)
+	if config.TransitionMatrix {
+		for r := 0; r <= config.MaxRank; r++ {
+			stats.Transitions = append(stats.Transitions, make([]int, config.MaxRank+1))
+		}
+	}
+	stats.FactionWins = make([]int, config.FactionCount)
+	stats.FactionMatches = make([]int, config.FactionCount)
+
+	return &stats
+}
+
+type SeasonSummary struct {
+	Season        int
+	Players       int
+	ActivePlayers int
+	Matches       int
+	ProCutOff     float64
+	Ragequits     int           //Players that hit FailedMatchMaking and gave up on the season
+	MatchingTime  time.Duration //Spent in the matchmaking loop
+	RankShares    []float64     //Share of the players not retired at each rank when the season ended
+}
+
+type Simulation struct {
+	Config    Config
+	Players   []Player        //Everyone that has joined so far, filled in by Run
+	Summaries []SeasonSummary //One per season played
+	NextId    int             //Id the next new player gets. Ids count up from 0 over the whole simulation, so a player's Id is also their index into Players.
+	Season    int             //First season Run plays. Past 0 when resuming from a snapshot.
+	rng       *rand.Rand
+	source    *pcgSource                //rng's source, kept to save and restore its state with -snapshot
+	buckets   [][]int                   //Players with games by rank, kept between seasons to reuse the backing arrays
+	OnSeason  func(result SeasonResult) //Called with each season's rankings as soon as they're in. Optional.
+}
+
+type AggregateRankStat struct {
+	Rank        int
+	PlayerCount Estimate
+	AvgSkill    Estimate
+	StdDev      Estimate
+}
+
+type Estimate struct {
+	Mean      float64
+	HalfWidth float64 //The 95% confidence interval is Mean ± HalfWidth
+	Runs      int     //Runs the estimate is based on
+}
+
+type SeasonResult struct {
+	Season            int
+	TotalPlayers      int
+	PlayersSittingOut int
+	Ranks             []RankStat
+	FactionWinRates   []*float64 `json:",omitempty"` //Only with FactionCount > 1
+	Transitions       [][]int    `json:",omitempty"` //Only with TransitionMatrix
+	FirstWinRate      *float64   `json:",omitempty"` //Win rate of the player going first. Only with CoinFlipAdvantage or SkillDimensions.
+	ResetRanks        []int      //Returning players by their rank after the season reset, indexed by rank
+}
+
+type RankStat struct {
+	Rank                int
+	PlayerCount         int
+	AvgGamesPlayed      float64 //Averages over players are left at zero when PlayerCount is 0
+	AvgSkill            float64
+	MedianSkill         float64
+	StdDev              float64
+	SkillGini           float64  //Inequality of skill within the rank, 0 when everyone is equal
+	AvgSkillGap         *float64 `json:",omitempty"` //Skill difference between opponents, over matches played at this rank
+	P95SkillGap         *float64 `json:",omitempty"`
+	AvgProgressionCount float64  `json:",omitempty"` //n/a at Pro Rank, there's nothing to progress past
+	MedianGamesToReach  *float64 `json:",omitempty"` //Games played when first reaching this rank, over every player that has
+	P90GamesToReach     *float64 `json:",omitempty"`
+	Ragequits           int      //Players that ragequit the season here after failing matchmaking
+	FavoriteWinRate     *float64 `json:",omitempty"` //Rates are nil when there was nothing to take a rate of
+	UpsetRate           *float64 `json:",omitempty"` //Share of decided matches the lower skilled player won
+	AvgPieces           float64
+	PiecesEarned        int
+	PiecesLost          int
+	Retention           *float64 `json:",omitempty"` //Of the players that finished last season at this rank
+	ChurnRate           *float64 `json:",omitempty"` //Of the players that finished last season at this rank. Only with ChurnProbability.
+	NewcomerWinRate     *float64 `json:",omitempty"`
+	AvgWinRate          *float64 `json:",omitempty"`
+	AvgDrawRate         *float64 `json:",omitempty"`
+	AvgQueueTime        *float64 `json:",omitempty"` //Only with QueueExpansion
+	P95QueueTime        *float64 `json:",omitempty"`
+	SmurfCount          int      `json:",omitempty"` //Only with SmurfRate
+	SmurfGamesToEscape  *float64 `json:",omitempty"` //Average games smurfs took to first get past this rank, over every smurf that has
+	Placements          int      `json:",omitempty"` //Players that finished calibration at this rank this season. Only with CalibrationGames.
+	PiecesToLeave       int      `json:",omitempty"` //Only with RankPieces, 0 at Pro Rank
+	MedianGamesInRank   *float64 `json:",omitempty"` //Games between first reaching this rank and first reaching the one below it, over every player that has. Only with RankPieces.
+	AvgElo              float64  `json:",omitempty"` //Only with RatingSystem "elo"
+	AvgGlickoRating     float64  `json:",omitempty"` //Only with RatingSystem "glicko"
+	AvgGlickoDeviation  float64  `json:",omitempty"`
+	AvgMMR              float64  `json:",omitempty"` //Only with RatingSystem "mmr"
+	AvgMMRRankGap       float64  `json:",omitempty"` //Ranks between where players are and where their MMR would put them
+}
+
+type Glicko struct {
+	rating     float64
+	deviation  float64
+	volatility float64
+	//Sums over the current rating period, applied by applyGlicko at the end of the season
+	vInverse    float64
+	improvement float64
+}
+
+type RankSystem interface {
+	//How wins and losses move a player on the ladder, selected by LadderType
+	OnWin(p *Player)
+	OnLoss(p *Player)
+	RankOf(p *Player) int
+}
+
+type PieceRankSystem struct {
+	config *Config
+}
+
+type SimpleRankSystem struct {
+	config *Config
+}
+
+type Skill struct {
+	max    float64
+	offset int
+	rate   float64
+	mode   string  //"flat" stays at max. "learn" climbs towards max with games played, "inverse" falls from it.
+	curve  string  //See CurveType
+	floor  float64 //Lowest an "inverse" skill falls to
+	second float64 //Max of the second component, only with SkillDimensions
+	Calc   func(skill *Skill, gamesPlayed int) float64
+}
+
+func CalcSkill(skill *Skill, gamesPlayed int) float64 {
+	if skill.mode == "flat" {
+		return skill.max
+	}
+
+	//How far along the curve the player is, from 0 to 1
+	progress := calcSkillArctan(skill, gamesPlayed)
+	if skill.curve == "logistic" {
+		progress = calcSkillLogistic(skill, gamesPlayed)
+	} else if skill.curve == "power" {
+		progress = calcSkillPower(skill, gamesPlayed)
+	}
+
+	if skill.mode == "inverse" {
+		return math.Max(skill.max*(1.0-progress), math.Min(skill.floor, skill.max))
+	}
+	return skill.max * progress
+}
+
+func calcSkillArctan(skill *Skill, gamesPlayed int) float64 {
+	return float64(.5 + math.Atan(float64(gamesPlayed+skill.offset)/float64(skill.rate))/math.Pi)
+}
+
+func calcSkillLogistic(skill *Skill, gamesPlayed int) float64 {
+	//Scaled by 4/pi so it's as steep as the arctan curve halfway up
+	return 1.0 / (1.0 + math.Exp(-4.0/math.Pi*float64(gamesPlayed+skill.offset)/skill.rate))
+}
+
+func calcSkillPower(skill *Skill, gamesPlayed int) float64 {
+	//Power law of practice, 1-(1+t)^-1. Nothing is learned until the offset is played through, then every game is worth less than the last.
+	t := math.Max(0, float64(gamesPlayed+skill.offset)/skill.rate)
+	return 1.0 - 1.0/(1.0+t)
+}
+
+func learnMode(config *Config) string {
+	if !config.Learn {
+		return "flat"
+	}
+	if config.InverseLearning {
+		return "inverse"
+	}
+	return "learn"
+}
+
+func NewPlayer(id int, skill float64, games int, variance int, season int, rng *rand.Rand, config *Config) Player {
+	player := Player{}
+	player.Id = id
+	player.JoinedSeason = season
+	player.Season = season
+	player.GamesPerSeason = games
+	player.SeasonalVariance = variance
+	player.LastSeasonRank = -1
+	player.EloRating = EloStart
+	player.Glicko = Glicko{rating: 1500, deviation: 350, volatility: 0.06}
+	player.MMR = skillCenter(config)
+	player.Calibrating = config.CalibrationGames > 0
+	player.Rank = newcomerRank(rng, config)
+	if config.SmurfRate > 0 && rng.Float64() < config.SmurfRate {
+		player.Smurf = true
+		player.Rank = config.MaxRank
+	}
+	player.RankProgression = make([]RankProgression, 0)
+	for i := config.MaxRank; i >= player.Rank; i-- {
+		player.RankProgression = append(player.RankProgression, RankProgression{Rank: i, GamesPlayed: 0, Season: season})
+	}
+	if config.RankProgressionMode == "summary" {
+		player.RankProgression = player.RankProgression[len(player.RankProgression)-1:]
+	}
+
+	player.Skill = Skill{
+		max:    drawSkill(rng, config),
+		offset: int((rng.Float64() - .5) * float64(config.SkillOffsetScale)),
+		rate:   float64(config.SkillOffsetScale) * config.LearnFactor / (1.0 + (rng.Float64() * (config.LearnScale - 1.0))), //This looks complicated, but pins the learning rate to the skill offset rate
+		mode:   learnMode(config),
+		curve:  config.CurveType,
+		floor:  config.InverseLearnFloor,
+		Calc:   CalcSkill}
+	if player.Smurf {
+		//Top fifth of the skill range, and the offset puts them past the midpoint of their learning curve
+		player.Skill.max = skillInBand(0.8+rng.Float64()*0.2, config)
+		player.Skill.offset += config.SkillOffsetScale
+	}
+	if config.SkillDimensions {
+		player.Skill.second = drawSkill(rng, config)
+		if player.Smurf {
+			player.Skill.second = skillInBand(0.8+rng.Float64()*0.2, config)
+		}
+	}
+	if config.FactionCount > 1 {
+		//Up to a fifth better or worse than their skill with each faction
+		player.Factions = make([]float64, config.FactionCount)
+		for f := 0; f < config.FactionCount; f++ {
+			player.Factions[f] = 0.8 + rng.Float64()*0.4
+		}
+	}
+
+	setPlayerForSeason(&player, false, rng, config)
+
+	return player
+}
+
+func drawSkill(rng *rand.Rand, config *Config) float64 {
+	if config.SkillDistribution == "normal" {
+		return skillInBand(math.Max(0, math.Min(1, config.SkillMean+rng.NormFloat64()*config.SkillStdDev)), config)
+	} else if config.SkillDistribution == "beta" {
+		//X/(X+Y) is beta distributed when X and Y are gamma distributed with the two shapes
+		x := drawGamma(rng, config.SkillBetaAlpha)
+		y := drawGamma(rng, config.SkillBetaBeta)
+		return skillInBand(x/(x+y), config)
+	}
+	return skillInBand(rng.Float64(), config)
+}
+
+func skillInBand(skill float64, config *Config) float64 {
+	//Maps [0, 1] onto [SkillMin, SkillMax]
+	return config.SkillMin + (config.SkillMax-config.SkillMin)*skill
+}
+
+func skillCenter(config *Config) float64 {
+	//An average player, 0.5 on the default band
+	return (config.SkillMin + config.SkillMax) / 2
+}
+
+func drawGamma(rng *rand.Rand, shape float64) float64 {
+	//Marsaglia and Tsang's method, with scale 1
+	if shape < 1 {
+		//Boost to shape+1 and scale back down, the method needs shape >= 1
+		return drawGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+
+	d := shape - 1.0/3.0
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+func newcomerRank(rng *rand.Rand, config *Config) int {
+	total := 0.0
+	for r := 0; r < len(config.NewcomerRankDistribution); r++ {
+		total += config.NewcomerRankDistribution[r]
+	}
+	if total <= 0 {
+		return config.MaxRank
+	}
+
+	roll := rng.Float64() * total
+	rank := config.MaxRank
+	for r := 0; r < len(config.NewcomerRankDistribution); r++ {
+		if config.NewcomerRankDistribution[r] <= 0 {
+			continue
+		}
+		rank = r
+		if roll < config.NewcomerRankDistribution[r] {
+			break
+		}
+		roll -= config.NewcomerRankDistribution[r]
+	}
+
+	return rank
+}
+
+func initPlayers(count int, gamesPlayed int, nextId *int, season int, rng *rand.Rand, config *Config) []Player {
+	players := make([]Player, count)
+
+	//Ids come from one counter for the whole simulation, so they stay unique and contiguous whatever the per season counts
+	for i := 0; i < count; i++ {
+		players[i] = NewPlayer(*nextId, rng.Float64(), int(rng.Float64()*float64(gamesPlayed)), int(rng.Float64()*float64(config.SeasonalVariance)), season, rng, config)
+		*nextId++
+		//Games played all start at 0, so the games drawn for the player's seasons are what skill follows. Smurfs already have their skill picked out.
+		if config.SkillGamesCorrelation > 0 && gamesPlayed > 0 && !players[i].Smurf && rng.Float64() < config.SkillGamesCorrelation {
+			players[i].Skill.max = skillInBand(float64(players[i].GamesPerSeason)/float64(gamesPlayed), config)
+		}
+	}
+
+	if config.Debug && config.SkillGamesCorrelation > 0 {
+		skills := make([]float64, 0)
+		games := make([]float64, 0)
+		for i := 0; i < len(players); i++ {
+			skills = append(skills, players[i].Skill.max)
+			games = append(games, float64(players[i].GamesPerSeason))
+		}
+		log.Println("Season", season, "new players' max skill and games per season correlation:", correlation(skills, games))
+	}
+
+	return players
+}
+
+func churns(p *Player, rng *rand.Rand, config *Config) bool {
+	//Judged on how last season went, before the player is set up for this one
+	chance := config.ChurnProbability * (2.0 - p.Skill.Calc(&p.Skill, p.GamesPlayed))
+	if p.Streak < 0 {
+		chance *= 1.5
+	}
+	if p.FailedMatchMaking > config.FailedMatchMaking {
+		chance *= 2.0
+	}
+	return rng.Float64() < chance
+}
+
+func setPlayerForSeason(p *Player, resetRank bool, rng *rand.Rand, config *Config) bool {
+	p.Party = -1
+	p.QueueTime = 0
+	if resetRank {
+		//3 ranks on the default 30 rank ladder
+		drop := int(math.Max(1, math.Round(float64(config.MaxRank)/10)))
+		if config.SeasonResetOffset >= 0 {
+			drop = config.SeasonResetOffset
+		}
+		floor := config.MaxRank
+		if config.SeasonResetFloor >= 0 {
+			floor = config.SeasonResetFloor
+		}
+		if p.Rank+drop <= floor {
+			p.Rank = p.Rank + drop
+		} else if p.Rank < floor {
+			p.Rank = floor
+		}
+		if config.ResetPiecesOnSeason {
+			p.Pieces = 0
+			p.Streak = 0
+		}
+	}
+	if config.FixedGamesPerSeason > 0 {
+		p.GamesLeft = config.FixedGamesPerSeason
+		p.IdleSeasons = 0
+		return false
+	}
+	p.GamesLeft = p.GamesPerSeason + int((rng.Float64()-0.5)*float64(p.SeasonalVariance))
+	if p.GamesLeft < 0 {
+		p.GamesLeft = 0
+	}
+	if p.GamesLeft > 0 {
+		p.IdleSeasons = 0
+		return false
+	}
+	//Rust only sets in once the player has been away longer than the grace period
+	p.IdleSeasons++
+	return p.IdleSeasons > config.IdleSeasonsBeforeDecay && decaySkill(p, config)
+}
+
+func decaySkill(p *Player, config *Config) bool {
+	//Only the learn curve can be forgotten, flat skill never moves and inverse players lose skill by playing
+	if config.SkillDecayPerSeason <= 0 || p.Skill.mode != "learn" {
+		return false
+	}
+	//Experience is how far along the curve the player is, never decays past a player that has yet to play
+	experience := p.GamesPlayed + p.Skill.offset
+	if p.GamesPlayed == 0 || experience <= 0 {
+		return false
+	}
+	p.Skill.offset -= int(math.Round(float64(experience) * config.SkillDecayPerSeason))
+	return true
+}
+
+func RunWithPlayers(players []Player, config Config) ([]SeasonResult, error) {
+	//Plays the seasons on a hand-picked population instead of generated players, writing the same output as a normal run. Nobody else joins, whatever PlayersPerSeason says.
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	config.PlayersPerSeason = 0
+	sim := NewSimulation(config)
+
+	for i := 0; i < len(players); i++ {
+		p := &players[i]
+		//A player's Id is their index into Players
+		if p.Id != i {
+			return nil, fmt.Errorf("player %d has Id %d, Ids must count up from 0 in order", i, p.Id)
+		}
+		if p.Rank < 0 || p.Rank > config.MaxRank {
+			return nil, fmt.Errorf("player %d has rank %d, outside 0 to MaxRank %d", i, p.Rank, config.MaxRank)
+		}
+		if p.Skill.max < config.SkillMin || p.Skill.max > config.SkillMax {
+			return nil, fmt.Errorf("player %d has max skill %v, outside SkillMin %v to SkillMax %v", i, p.Skill.max, config.SkillMin, config.SkillMax)
+		}
+		//MMR starts at the middle of the band, like a new player's
+		if p.GamesPlayed == 0 {
+			p.MMR = skillCenter(&sim.Config)
+		}
+		if p.Skill.Calc == nil {
+			p.Skill.Calc = CalcSkill
+		}
+		//Players without a learning mode learn the way the config says, like generated players
+		if p.Skill.mode == "" {
+			p.Skill.mode = learnMode(&sim.Config)
+			p.Skill.curve = sim.Config.CurveType
+			p.Skill.floor = sim.Config.InverseLearnFloor
+		}
+		//Wins read the player's latest progression
+		if len(p.RankProgression) == 0 {
+			p.RankProgression = []RankProgression{{Rank: p.Rank, GamesPlayed: p.GamesPlayed, Season: p.Season}}
+		}
+		//Ready for the first season like NewPlayer leaves a new player, which also draws their games for it
+		setPlayerForSeason(p, false, sim.rng, &sim.Config)
+	}
+	sim.Players = players
+	sim.NextId = len(players)
+	log.Println("Starting from", len(players), "given players")
+
+	return RunAndReport(sim), nil
+}
+
+func RunMany(config *Config) {
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	log.Println("Seed:", config.Seed)
+	checkError("Cannot create output directory: ", makeOutputDir(config))
+
+	parallel := config.Parallel
+	if parallel == 0 {
+		parallel = runtime.NumCPU()
+	}
+
+	//Each run has its own Simulation and rng, so they share nothing but the config
+	results := make([][]RankStat, config.Runs)
+	runs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				runConfig := *config
+				runConfig.Seed = config.Seed + int64(run)
+				seasons := NewSimulation(runConfig).Run()
+				if len(seasons) > 0 {
+					results[run] = seasons[len(seasons)-1].Ranks
+				}
+			}
+		}()
+	}
+	for run := 0; run < config.Runs; run++ {
+		runs <- run
+	}
+	close(runs)
+	wg.Wait()
+
+	aggregate := aggregateResults(results)
+	writeAggregate(aggregate, config)
+	printAggregate(aggregate, config.Runs)
+}
+
+func aggregateResults(results [][]RankStat) []AggregateRankStat {
+	ranks := 0
+	for run := 0; run < len(results); run++ {
+		for i := 0; i < len(results[run]); i++ {
+			if results[run][i].Rank+1 > ranks {
+				ranks = results[run][i].Rank + 1
+			}
+		}
+	}
+
+	playerCounts := make([][]float64, ranks)
+	skills := make([][]float64, ranks)
+	stdDevs := make([][]float64, ranks)
+	for run := 0; run < len(results); run++ {
+		for i := 0; i < len(results[run]); i++ {
+			stat := results[run][i]
+			playerCounts[stat.Rank] = append(playerCounts[stat.Rank], float64(stat.PlayerCount))
+			//Skill only means something for runs that had players at this rank
+			if stat.PlayerCount > 0 {
+				skills[stat.Rank] = append(skills[stat.Rank], stat.AvgSkill)
+				stdDevs[stat.Rank] = append(stdDevs[stat.Rank], stat.StdDev)
+			}
+		}
+	}
+
+	aggregate := make([]AggregateRankStat, ranks)
+	for r := 0; r < len(aggregate); r++ {
+		aggregate[r] = AggregateRankStat{Rank: r, PlayerCount: estimate(playerCounts[r]), AvgSkill: estimate(skills[r]), StdDev: estimate(stdDevs[r])}
+	}
+	return aggregate
+}
+
+func estimate(values []float64) Estimate {
+	//Normal approximation of the 95% confidence interval of the mean. Needs at least two runs, fewer leave HalfWidth at 0.
+	if len(values) == 0 {
+		return Estimate{}
+	}
+	n := float64(len(values))
+	mean := 0.0
+	for i := 0; i < len(values); i++ {
+		mean += values[i]
+	}
+	mean /= n
+	if len(values) < 2 {
+		return Estimate{Mean: mean, Runs: len(values)}
+	}
+
+	variance := 0.0
+	for i := 0; i < len(values); i++ {
+		variance += (values[i] - mean) * (values[i] - mean)
+	}
+	variance /= n - 1
+
+	return Estimate{Mean: mean, HalfWidth: 1.96 * math.Sqrt(variance/n), Runs: len(values)}
+}
+
+func printAggregate(aggregate []AggregateRankStat, runs int) {
+	//Goes to stdout like printReport
+	fmt.Println("Runs:", runs)
+	for i := 0; i < len(aggregate); i++ {
+		fmt.Println("Rank", aggregate[i].Rank, "\tPlayers:", formatEstimate(aggregate[i].PlayerCount), "\tSkill:", formatEstimate(aggregate[i].AvgSkill), "\tStdDev:", formatEstimate(aggregate[i].StdDev))
+	}
+}
+
+func formatEstimate(e Estimate) string {
+	if e.Runs == 0 {
+		return "n/a"
+	}
+	if e.Runs < 2 {
+		return fmt.Sprintf("%.4f (1 run)", e.Mean)
+	}
+	return fmt.Sprintf("%.4f ± %.4f", e.Mean, e.HalfWidth)
+}
+
+func writeAggregate(aggregate []AggregateRankStat, config *Config) {
+	file, err := os.Create(outputName(config) + "Aggregate.csv")
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	err = writer.Write([]string{"Rank", "Player Count", "Player Count CI", "Player Count Runs", "Average Skill", "Average Skill CI", "Average Skill Runs", "Std Dev", "Std Dev CI", "Std Dev Runs"})
+	checkError("Cannot write to file", err)
+
+	for i := 0; i < len(aggregate); i++ {
+		row := []string{strconv.Itoa(aggregate[i].Rank)}
+		estimates := []Estimate{aggregate[i].PlayerCount, aggregate[i].AvgSkill, aggregate[i].StdDev}
+		for e := 0; e < len(estimates); e++ {
+			//A single run has no interval, so its CI is left blank like formatEstimate leaves it off
+			halfWidth := ""
+			if estimates[e].Runs >= 2 {
+				halfWidth = fmt.Sprintf("%f", estimates[e].HalfWidth)
+			}
+			row = append(row, fmt.Sprintf("%f", estimates[e].Mean), halfWidth, strconv.Itoa(estimates[e].Runs))
+		}
+		err = writer.Write(row)
+		checkError("Cannot write to file", err)
+	}
+}
+
+func NewSimulation(config Config) *Simulation {
+	//A zero seed picks one from the clock. It's kept on the config so the run can be replayed.
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	source := newPCGSource(config.Seed)
+	return &Simulation{
+		Config:    config,
+		Players:   make([]Player, 0),
+		Summaries: make([]SeasonSummary, 0),
+		rng:       rand.New(source),
+		source:    source}
+}
+
+type pcgSource struct {
+	pcg *randv2.PCG
+}
+
+func newPCGSource(seed int64) *pcgSource {
+	//math/rand's own source can't be saved, PCG's state can. Wrapping it keeps *rand.Rand everywhere else.
+	return &pcgSource{pcg: randv2.NewPCG(uint64(seed), uint64(seed))}
+}
+
+func (source *pcgSource) Int63() int64 {
+	return int64(source.pcg.Uint64() >> 1)
+}
+
+func (source *pcgSource) Seed(seed int64) {
+	source.pcg.Seed(uint64(seed), uint64(seed))
+}
+
+func (source *pcgSource) MarshalBinary() ([]byte, error) {
+	return source.pcg.MarshalBinary()
+}
+
+func (source *pcgSource) UnmarshalBinary(data []byte) error {
+	return source.pcg.UnmarshalBinary(data)
+}
+
+func RunAndReport(sim *Simulation) []SeasonResult {
+	config := &sim.Config
+	log.Println("Seed:", config.Seed)
+	checkError("Cannot create output directory: ", makeOutputDir(config))
+
+	//Results are written as each season ends, so a crash keeps the seasons already played
+	if config.StreamOutput {
+		file, err := os.Create(outputName(config) + ".csv")
+		checkError("Cannot create file", err)
+		defer file.Close()
+
+		writer := csv.NewWriter(file)
+		err = writer.Write(append([]string{"Season"}, csvHeader(config)...))
+		checkError("Cannot write to file", err)
+		sim.OnSeason = func(result SeasonResult) {
+			streamSeasonResult(writer, result, config)
+			writeTransitions(result, config)
+			if config.LeaderboardEverySeason {
+				writeLeaderboard(sim.Players, result.Season, config)
+			}
+		}
+	} else {
+		sim.OnSeason = func(result SeasonResult) {
+			writeSeasonResult(result, config)
+			writeTransitions(result, config)
+			if config.LeaderboardEverySeason {
+				writeLeaderboard(sim.Players, result.Season, config)
+			}
+		}
+	}
+	results := sim.Run()
+	if !config.LeaderboardEverySeason {
+		writeLeaderboard(sim.Players, config.Seasons-1, config)
+	}
+
+	timeToProStats(sim.Players)
+	printReport(sim.Summaries, config)
+	return results
+}
+
+func LoadScenarios(path string) ([]Scenario, error) {
+	//A JSON array of configs, each with a Name. Anything a scenario leaves out keeps its default.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+
+	scenarios := make([]Scenario, 0)
+	names := make(map[string]bool)
+	for i := 0; i < len(raw); i++ {
+		//Decoding every scenario up front means a typo fails here instead of after the scenarios before it have run
+		scenario := Scenario{Config: DefaultConfig()}
+		decoder := json.NewDecoder(bytes.NewReader(raw[i]))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&scenario); err != nil {
+			return nil, fmt.Errorf("cannot parse scenario %d of %s: %w", i, path, err)
+		}
+
+		//The name becomes a directory, so it has to be one path element
+		if scenario.Name == "" || scenario.Name == "." || scenario.Name == ".." || strings.ContainsAny(scenario.Name, `/\`) {
+			return nil, fmt.Errorf("scenario %d of %s needs a Name usable as a directory, got %q", i, path, scenario.Name)
+		}
+		if names[scenario.Name] {
+			return nil, fmt.Errorf("%s has more than one scenario named %q", path, scenario.Name)
+		}
+		names[scenario.Name] = true
+
+		if scenario.Runs > 1 {
+			return nil, fmt.Errorf("scenario %q has Runs %d, each scenario is a single simulation", scenario.Name, scenario.Runs)
+		}
+		if err := scenario.Validate(); err != nil {
+			return nil, fmt.Errorf("scenario %q: %w", scenario.Name, err)
+		}
+		scenarios = append(scenarios, scenario)
+	}
+
+	return scenarios, nil
+}
+
+func PrintScenarioTable(results []ScenarioResult) {
+	//One line of headline numbers per scenario, to compare a suite at a glance
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Scenario\tSeed\tSeasons\tPlayers\tActive Players\tMatches\tPro Cutoff")
+	for i := 0; i < len(results); i++ {
+		summaries := results[i].Summaries
+		if len(summaries) == 0 {
+			fmt.Fprintf(writer, "%s\t%d\t0\t\t\t\t\n", results[i].Name, results[i].Seed)
+			continue
+		}
+		matches := 0
+		for s := 0; s < len(summaries); s++ {
+			matches += summaries[s].Matches
+		}
+		last := summaries[len(summaries)-1]
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\t%d\t%f\n", results[i].Name, results[i].Seed, len(summaries), last.Players, last.ActivePlayers, matches, last.ProCutOff)
+	}
+	writer.Flush()
+}
+
+func (sim *Simulation) Run() []SeasonResult {
+	config := &sim.Config
+	results := make([]SeasonResult, 0)
+
+	log.Println("Playing", config.Seasons, "season(s), adding", config.PlayersPerSeason, "players each season with an average", config.GamesPerSeason/2, "games played per season.")
+
+	//Timeline of the player followed with TracePlayer
+	var trace *csv.Writer
+	if config.TracePlayer >= 0 {
+		file, err := os.Create(outputName(config) + "Trace" + strconv.Itoa(config.TracePlayer) + ".csv")
+		checkError("Cannot create file", err)
+		defer file.Close()
+
+		trace = csv.NewWriter(file)
+		defer trace.Flush()
+		err = trace.Write([]string{"Season", "Event", "Rank", "Pieces", "Games Played"})
+		checkError("Cannot write to file", err)
+	}
+
+	for s := sim.Season; s < config.Seasons; s++ {
+		results = append(results, sim.runSeason(s, trace))
+
+		if config.Snapshot != "" {
+			rngState, err := sim.source.MarshalBinary()
+			checkError("Cannot save snapshot: ", err)
+			checkError("Cannot save snapshot: ", SaveState(config.Snapshot, sim.Players, s+1, config.Seed, rngState))
+		}
+	}
+
+	return results
+}
+
+func (sim *Simulation) runSeason(s int, trace *csv.Writer) SeasonResult {
+	//One season on sim.Players, separate from Run so a season can be timed on its own
+	config := &sim.Config
+	rng := sim.rng
+	players := sim.Players
+	ranks := rankSystem(config)
+	//Only read once the traced player is on the ladder this season
+	tracedRank := -1
+
+	//Season init
+	players = append(players, initPlayers(config.PlayersPerSeason, config.GamesPerSeason, &sim.NextId, s, rng, config)...)
+	playersWithGames := make([]int, 0)
+	//Emptied rather than remade, last season's arrays fit about the same players
+	if sim.buckets == nil {
+		sim.buckets = make([][]int, config.MaxRank+1)
+	}
+	playersWGBR := sim.buckets
+	for r := 0; r < len(playersWGBR); r++ {
+		playersWGBR[r] = playersWGBR[r][:0]
+	}
+	stats := NewSeasonStats(config)
+
+	//Get rating of the Pro Rank leaderboard
+	proPlayers := make([]*Player, 0)
+	for i := 0; i < len(players); i++ {
+		if players[i].Rank == 0 && !players[i].Retired {
+			proPlayers = append(proPlayers, &players[i])
+		}
+	}
+
+	//Find the cut for Pro Rank, on whichever rating the config keeps
+	rating := proRating(config)
+	proCutOff := proRankCutoff(proPlayers, config.ProRankSize, rating)
+
+	if config.Debug {
+		log.Println("ProRank", config.RatingSystem, "cutoff:", proCutOff)
+	}
+
+	playersSittingOut := 0
+	playersDecayed := 0
+	for i := 0; i < len(players); i++ {
+		players[i].Season = s
+		if players[i].Retired {
+			playersSittingOut++
+			continue
+		}
+		//Players added this season were already set up by NewPlayer, rolling them again would double their setup and reset their newcomer rank
+		event := "Joined"
+		if s != 0 && players[i].JoinedSeason != s {
+			returned := false
+			if config.ChurnProbability > 0 && churns(&players[i], rng, config) {
+				event = "Retired"
+				players[i].Retired = true
+				players[i].GamesLeft = 0
+				if players[i].LastSeasonRank >= 0 {
+					stats.Churned[players[i].LastSeasonRank]++
+				}
+			} else if players[i].Rank == 0 && proCutOff < rating(&players[i]) {
+				//If players are in the Pro Rank leaderboard, don't derank. Hell, don't even play them for efficiency. Their games aren't counted as played, so they don't learn from matches that never happened.
+				event = "Kept Pro Rank"
+				if setPlayerForSeason(&players[i], false, rng, config) {
+					playersDecayed++
+				}
+				returned = players[i].GamesLeft > 0
+				players[i].GamesLeft = 0
+			} else {
+				event = "Season Reset"
+				if config.ContinuousLadder {
+					event = "Season Start"
+				}
+				if setPlayerForSeason(&players[i], !config.ContinuousLadder, rng, config) {
+					playersDecayed++
+				}
+				if config.Debug && config.ContinuousLadder && players[i].Rank != players[i].LastSeasonRank {
+					panic("rank changed between seasons on a continuous ladder")
+				}
+				stats.ResetRanks[players[i].Rank]++
+				returned = players[i].GamesLeft > 0
+			}
+
+			if players[i].LastSeasonRank >= 0 {
+				stats.LastSeasonPlayers[players[i].LastSeasonRank]++
+				if returned {
+					stats.Retained[players[i].LastSeasonRank]++
+				}
+			}
+		}
+		if trace != nil && i == config.TracePlayer {
+			tracedRank = players[i].Rank
+			traceEvent(trace, &players[i], event)
+		}
+		if config.SampleRate < 1.0 {
+			players[i].DeferredGames = players[i].GamesLeft - int(math.Ceil(float64(players[i].GamesLeft)*config.SampleRate))
+			players[i].GamesLeft -= players[i].DeferredGames
+		}
+		if players[i].GamesLeft > 0 {
+			playersWithGames = append(playersWithGames, i)
+			playersWGBR[ranks.RankOf(&players[i])] = append(playersWGBR[ranks.RankOf(&players[i])], i)
+		} else {
+			playersSittingOut++
+		}
+	}
+
+	stats.ActivePlayers = len(players) - playersSittingOut
+
+	//Ranks after the season reset, to compare against where players finish
+	startRanks := make([]int, 0)
+	for i := 0; i < len(players) && config.TransitionMatrix; i++ {
+		startRanks = append(startRanks, players[i].Rank)
+	}
+
+	parties := make([][]int, 0)
+	if config.PartyRate > 0 {
+		parties = formParties(players, playersWithGames, playersWGBR, rng, config)
+	}
+
+	if config.Debug {
+		log.Println(playersSittingOut, "players are sitting out this season.")
+		log.Println(playersDecayed, "players lost skill while sitting out.")
+		log.Println(len(parties), "parties formed this season.")
+	}
+
+	//Start playing games
+	matchesPlayed := 0
+	lastStarvationWarning := make([]int, config.MaxRank+1)
+	for r := 0; r < len(lastStarvationWarning); r++ {
+		lastStarvationWarning[r] = -config.StarvationWarningInterval
+	}
+	lastProgress := time.Now()
+	matchingStarted := lastProgress
+	startingPlayers := len(playersWithGames)
+	if startingPlayers < 2 {
+		log.Println("Season", s, "has", startingPlayers, "player(s) with games, the population is too small to match across", config.MaxRank+1, "ranks")
+	}
+	for len(playersWithGames) > 1 {
+		//Catches the traced player's last match, whichever branch below played it
+		traceRankChange(trace, players, &tracedRank, config)
+		//Only checks the clock every 1000 matches, a season can run millions
+		if config.Progress && matchesPlayed%1000 == 0 && time.Since(lastProgress) >= time.Duration(config.ProgressInterval)*time.Second {
+			log.Println("Season", s, "\tMatches:", matchesPlayed, "\tPlayersLeft:", len(playersWithGames))
+			lastProgress = time.Now()
+		}
+		aGamesIndex := int(rng.Float64() * float64(len(playersWithGames)))
+		for d := 0; d < config.CalibrationPriority && !players[playersWithGames[aGamesIndex]].Calibrating; d++ {
+			aGamesIndex = int(rng.Float64() * float64(len(playersWithGames)))
+		}
+		aId := playersWithGames[aGamesIndex]
+		aRank := ranks.RankOf(&players[aId])
+
+		//Party members aren't in the rank buckets, they only play other parties
+		if players[aId].Party >= 0 {
+			var matched bool
+			playersWithGames, matched = playPartyMatch(players, parties, players[aId].Party, playersWithGames, playersWGBR, stats, rng, config)
+			if matched {
+				matchesPlayed++
+			}
+			continue
+		}
+
+		//Matchmaking
+		aRankedIndex := -1
+		for i := 0; i < len(playersWGBR[aRank]); i++ {
+			if players[playersWGBR[aRank][i]].Id == aId {
+				aRankedIndex = i
+				break
+			}
+		}
+
+		bRank, bRankedIndex, matched := findOpponent(players, playersWGBR, aRank, aRankedIndex, rng, config)
+
+		//If we matched, play
+		if matched {
+			bId := playersWGBR[bRank][bRankedIndex]
+
+			if config.QueueExpansion > 0 {
+				stats.QueueTimes[aRank] = append(stats.QueueTimes[aRank], players[aId].QueueTime)
+				stats.QueueTimes[bRank] = append(stats.QueueTimes[bRank], players[bId].QueueTime)
+				players[aId].QueueTime = 0
+				players[bId].QueueTime = 0
+			}
+
+			playMatch(&players[aId], &players[bId], stats, rng, config)
+			matchesPlayed++
+			aNewRank := ranks.RankOf(&players[aId])
+			bNewRank := ranks.RankOf(&players[bId])
+
+			//Move players in their ranks if they ranked or remove them if they're out of games
+			if players[aId].GamesLeft <= 0 {
+				if config.Debug {
+					log.Println("Removing", aId, "from lists")
+				}
+				//Remove from lists
+				playersWithGames[aGamesIndex] = playersWithGames[len(playersWithGames)-1]
+				playersWithGames = playersWithGames[:len(playersWithGames)-1]
+
+				playersWGBR[aRank][aRankedIndex] = playersWGBR[aRank][len(playersWGBR[aRank])-1]
+				playersWGBR[aRank] = playersWGBR[aRank][:len(playersWGBR[aRank])-1]
+			} else if aNewRank != aRank {
+				playersWGBR[aRank][aRankedIndex] = playersWGBR[aRank][len(playersWGBR[aRank])-1]
+				playersWGBR[aRank] = playersWGBR[aRank][:len(playersWGBR[aRank])-1]
+
+				if aNewRank != 0 {
+					playersWGBR[aNewRank] = append(playersWGBR[aNewRank], aId)
+				} else {
+					//ProRank players don't need to progress in this model, just end their season. Skipped games don't count towards GamesPlayed.
+					players[aId].GamesLeft = 0
+
+					playersWithGames[aGamesIndex] = playersWithGames[len(playersWithGames)-1]
+					playersWithGames = playersWithGames[:len(playersWithGames)-1]
+				}
+			}
+			if players[bId].GamesLeft <= 0 || bNewRank != bRank {
+				//If player A moved, we need to refind b's rankedIndex
+				if (players[aId].GamesLeft <= 0 || aNewRank != aRank) && bRank == aRank {
+					for i := 0; i < len(playersWGBR[bRank]); i++ {
+						if players[playersWGBR[bRank][i]].Id == bId {
+							bRankedIndex = i
+							break
+						}
+					}
+				}
+				bGamesIndex := -1
+				for i := 0; i < len(playersWithGames); i++ {
+					if playersWithGames[i] == bId {
+						bGamesIndex = i
+						break
+					}
+				}
+
+				if players[bId].GamesLeft <= 0 {
+					if config.Debug {
+						log.Println("Removing", bId, "from lists")
+					}
+					playersWithGames[bGamesIndex] = playersWithGames[len(playersWithGames)-1]
+					playersWithGames = playersWithGames[:len(playersWithGames)-1]
+
+					playersWGBR[bRank][bRankedIndex] = playersWGBR[bRank][len(playersWGBR[bRank])-1]
+					playersWGBR[bRank] = playersWGBR[bRank][:len(playersWGBR[bRank])-1]
+				} else if bNewRank != bRank {
+					playersWGBR[bRank][bRankedIndex] = playersWGBR[bRank][len(playersWGBR[bRank])-1]
+					playersWGBR[bRank] = playersWGBR[bRank][:len(playersWGBR[bRank])-1]
+
+					if bNewRank != 0 {
+						playersWGBR[bNewRank] = append(playersWGBR[bNewRank], bId)
+					} else {
+						//ProRank players don't need to progress in this model, just end their season. Skipped games don't count towards GamesPlayed.
+						players[bId].GamesLeft = 0
+
+						playersWithGames[bGamesIndex] = playersWithGames[len(playersWithGames)-1]
+						playersWithGames = playersWithGames[:len(playersWithGames)-1]
+					}
+				}
+			}
+		} else if config.QueueExpansion > 0 && config.MatchSearchWidth+players[aId].QueueTime*config.QueueExpansion < len(playersWGBR)-1 {
+			//Still widening the search, so a just waits longer
+			players[aId].QueueTime++
+		} else { //We didn't find a match, ding a, and with enough dings, ragequit
+			players[aId].FailedMatchMaking++
+			if players[aId].FailedMatchMaking > config.FailedMatchMaking {
+				stats.Ragequits[aRank]++
+				if config.Debug {
+					log.Println("Player", aId, "failed matchmaking, rank ", players[aId].Rank)
+				}
+				players[aId].GamesLeft = 0
+				players[aId].DeferredGames = 0
+
+				playersWithGames[aGamesIndex] = playersWithGames[len(playersWithGames)-1]
+				playersWithGames = playersWithGames[:len(playersWithGames)-1]
+
+				playersWGBR[aRank][aRankedIndex] = playersWGBR[aRank][len(playersWGBR[aRank])-1]
+				playersWGBR[aRank] = playersWGBR[aRank][:len(playersWGBR[aRank])-1]
+			}
+
+			//When nobody left can reach an opponent, they'd all ragequit one failed attempt at a time, so end the season now
+			if !anyMatchable(playersWithGames, playersWGBR, config) {
+				log.Println("Season", s, "ended early,", len(playersWithGames), "player(s) left with games have no opponent within", config.MatchSearchWidth, "ranks")
+				for i := 0; i < len(playersWithGames); i++ {
+					q := &players[playersWithGames[i]]
+					stats.Ragequits[ranks.RankOf(q)]++
+					q.FailedMatchMaking = config.FailedMatchMaking + 1
+					q.GamesLeft = 0
+					q.DeferredGames = 0
+				}
+				playersWithGames = playersWithGames[:0]
+				for r := 0; r < len(playersWGBR); r++ {
+					playersWGBR[r] = playersWGBR[r][:0]
+				}
+			}
+		}
+
+		//Only a's and b's ranks can have shrunk this round
+		if config.StarvationWarnings {
+			warnIfStarved(playersWGBR, aRank, matchesPlayed, lastStarvationWarning, config)
+			if matched && bRank != aRank {
+				warnIfStarved(playersWGBR, bRank, matchesPlayed, lastStarvationWarning, config)
+			}
+		}
+
+		if config.Debug {
+			//Ensure that our rank arrays have players with the right ranks. This is very slow
+			for r := 0; r < len(playersWGBR); r++ {
+				for i := 0; i < len(playersWGBR[r]); i++ {
+					if players[playersWGBR[r][i]].Rank != r {
+						log.Println(playersWGBR[r][i], players[playersWGBR[r][i]].Rank, r)
+						panic("rank mismatch")
+					}
+				}
+			}
+		}
+	}
+
+	matchingTime := time.Since(matchingStarted)
+
+	//Much cheaper than the Debug check, so it always runs. Logs instead of panicking so the rest of the run still finishes.
+	violations := bucketViolations(players, playersWithGames, playersWGBR)
+	for i := 0; i < len(violations) && i < 10; i++ {
+		log.Println("Season", s, "rank bucket violation:", violations[i])
+	}
+	if len(violations) > 0 {
+		log.Println("Season", s, "found", len(violations), "rank bucket violation(s), this season's results may be off")
+	}
+
+	//Everyone ragequit before finding an opponent, ranks are too sparse for this many players
+	if startingPlayers >= 2 && matchesPlayed == 0 {
+		log.Println("Season", s, "played no matches with", startingPlayers, "players, the population is too small to match across", config.MaxRank+1, "ranks")
+	}
+
+	traceRankChange(trace, players, &tracedRank, config)
+
+	if config.SampleRate < 1.0 {
+		playDeferredGames(players, rng, config)
+		traceRankChange(trace, players, &tracedRank, config)
+	}
+
+	//A Glicko-2 rating period is one season
+	if config.RatingSystem == "glicko" {
+		for i := 0; i < len(players); i++ {
+			applyGlicko(&players[i].Glicko, config)
+		}
+	}
+
+	//Players only retire at the start of a season, so they were never on the ladder this season
+	for i := 0; i < len(startRanks); i++ {
+		if !players[i].Retired {
+			stats.Transitions[startRanks[i]][players[i].Rank]++
+		}
+	}
+
+	if trace != nil && config.TracePlayer < len(players) && !players[config.TracePlayer].Retired {
+		traceEvent(trace, &players[config.TracePlayer], "Season End")
+	}
+	if trace != nil {
+		//Kept on disk as each season ends, like StreamOutput
+		trace.Flush()
+		checkError("Cannot write to file", trace.Error())
+	}
+
+	result := endStats(&players, s, stats, config)
+	//Deferred games aren't matches, so only the matchmaking loop is timed
+	log.Println("Season", s, "Matches:", matchesPlayed, "\tMatchesPerSecond:", int(float64(matchesPlayed)/math.Max(matchingTime.Seconds(), 1e-9)))
+	//Kept current so OnSeason can look at the players
+	sim.Players = players
+	if sim.OnSeason != nil {
+		sim.OnSeason(result)
+	}
+	for i := 0; i < len(players); i++ {
+		players[i].LastSeasonRank = players[i].Rank
+	}
+	ragequits := 0
+	for r := 0; r < len(stats.Ragequits); r++ {
+		ragequits += stats.Ragequits[r]
+	}
+	sim.Summaries = append(sim.Summaries, SeasonSummary{Season: s, Players: len(players), ActivePlayers: stats.ActivePlayers, Matches: matchesPlayed, ProCutOff: proCutOff, Ragequits: ragequits, MatchingTime: matchingTime, RankShares: rankShares(players, config)})
+
+	return result
+}
+
+func SaveState(path string, players []Player, season int, seed int64, rngState []byte) error {
+	//Written next to the old snapshot and swapped in, so a crash mid write keeps the last good one
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	encoder := gob.NewEncoder(file)
+	for _, value := range []interface{}{players, season, seed, rngState} {
+		if err := encoder.Encode(value); err != nil {
+			file.Close()
+			return fmt.Errorf("cannot write %s: %w", path, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func Resume(path string, config Config) (*Simulation, error) {
+	//Picks a -snapshot back up. Players, the next season and the seed come from the file, everything else from config.
+	players, season, seed, rngState, err := LoadState(path)
+	if err != nil {
+		return nil, err
+	}
+	//The snapshot may come from a longer ladder than config's
+	for i := 0; i < len(players); i++ {
+		if players[i].Rank < 0 || players[i].Rank > config.MaxRank {
+			return nil, fmt.Errorf("player %d in %s has rank %d, outside 0 to MaxRank %d", i, path, players[i].Rank, config.MaxRank)
+		}
+	}
+	sim := NewSimulation(config)
+	sim.Players = players
+	sim.NextId = len(players)
+	sim.Season = season
+	//Carry on with the generator exactly where the snapshot left it, so a resumed run matches an uninterrupted one
+	sim.Config.Seed = seed
+	err = sim.source.UnmarshalBinary(rngState)
+	if err != nil {
+		return nil, fmt.Errorf("cannot restore the generator from %s: %w", path, err)
+	}
+	log.Println("Resuming", len(players), "players from", path, "at season", season)
+	return sim, nil
+}
+
+func LoadState(path string) ([]Player, int, int64, []byte, error) {
+	players := make([]Player, 0)
+	season := 0
+	seed := int64(0)
+	rngState := make([]byte, 0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return players, season, seed, rngState, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(file)
+	for _, value := range []interface{}{&players, &season, &seed, &rngState} {
+		if err := decoder.Decode(value); err != nil {
+			return players, season, seed, rngState, fmt.Errorf("cannot parse %s: %w", path, err)
+		}
+	}
+
+	//Functions aren't saved
+	for i := 0; i < len(players); i++ {
+		players[i].Skill.Calc = CalcSkill
+	}
+
+	return players, season, seed, rngState, nil
+}
+
+func DiffCSV(pathA string, pathB string, tolerance float64) ([]string, error) {
+	//Cell by cell differences between two output CSVs, one line each. Numbers only differ when they're more than tolerance apart.
+	rowsA, err := readCSV(pathA)
+	if err != nil {
+		return nil, err
+	}
+	rowsB, err := readCSV(pathB)
+	if err != nil {
+		return nil, err
+	}
+	if len(rowsA) == 0 || len(rowsB) == 0 {
+		return nil, fmt.Errorf("%s and %s need a header row", pathA, pathB)
+	}
+	if strings.Join(rowsA[0], ",") != strings.Join(rowsB[0], ",") {
+		return []string{fmt.Sprintf("Headers differ: %v -> %v", rowsA[0], rowsB[0])}, nil
+	}
+
+	header := rowsA[0]
+	diffs := make([]string, 0)
+	for i := 1; i < len(rowsA) || i < len(rowsB); i++ {
+		if i >= len(rowsB) {
+			diffs = append(diffs, fmt.Sprintf("Row %d only in %s", i+1, pathA))
+			continue
+		} else if i >= len(rowsA) {
+			diffs = append(diffs, fmt.Sprintf("Row %d only in %s", i+1, pathB))
+			continue
+		}
+		//Rows are labelled by their first cell, the rank in every output
+		label := header[0] + " " + rowsA[i][0]
+		for c := 0; c < len(header); c++ {
+			a := rowsA[i][c]
+			b := rowsB[i][c]
+			if a == b {
+				continue
+			}
+			aValue, aErr := strconv.ParseFloat(a, 64)
+			bValue, bErr := strconv.ParseFloat(b, 64)
+			if aErr == nil && bErr == nil && math.Abs(aValue-bValue) <= tolerance {
+				continue
+			}
+			diffs = append(diffs, fmt.Sprintf("%s, %s: %s -> %s", label, header[c], a, b))
+		}
+	}
+	return diffs, nil
+}
+
+func readCSV(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return rows, nil
+}
+
+func LoadPlayersCSV(path string) ([]Player, error) {
+	//One player per row after the header: Id, Skill Max, Skill Offset, Skill Rate, Games Per Season, Rank. Learning mode, ratings and the rest start like a new player's. RunWithPlayers checks them against the config.
+	players := make([]Player, 0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return players, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 6
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return players, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+
+	//Rows are numbered from 1 like a spreadsheet, so the header is row 1
+	for i := 1; i < len(rows); i++ {
+		row := i + 1
+		id, err := strconv.Atoi(rows[i][0])
+		if err != nil {
+			return players, fmt.Errorf("%s row %d: Id %q isn't a whole number", path, row, rows[i][0])
+		}
+		skillMax, err := strconv.ParseFloat(rows[i][1], 64)
+		if err != nil || skillMax < 0 || skillMax > 1 {
+			return players, fmt.Errorf("%s row %d: Skill Max %q must be a number from 0 to 1", path, row, rows[i][1])
+		}
+		offset, err := strconv.Atoi(rows[i][2])
+		if err != nil {
+			return players, fmt.Errorf("%s row %d: Skill Offset %q isn't a whole number", path, row, rows[i][2])
+		}
+		rate, err := strconv.ParseFloat(rows[i][3], 64)
+		if err != nil || rate <= 0 {
+			return players, fmt.Errorf("%s row %d: Skill Rate %q must be a number above 0", path, row, rows[i][3])
+		}
+		games, err := strconv.Atoi(rows[i][4])
+		if err != nil || games < 0 {
+			return players, fmt.Errorf("%s row %d: Games Per Season %q must be a whole number, 0 or more", path, row, rows[i][4])
+		}
+		rank, err := strconv.Atoi(rows[i][5])
+		if err != nil || rank < 0 {
+			return players, fmt.Errorf("%s row %d: Rank %q must be a whole number, 0 or more", path, row, rows[i][5])
+		}
+
+		players = append(players, Player{
+			Id:             id,
+			Rank:           rank,
+			GamesPerSeason: games,
+			LastSeasonRank: -1,
+			EloRating:      EloStart,
+			Glicko:         Glicko{rating: 1500, deviation: 350, volatility: 0.06},
+			Skill:          Skill{max: skillMax, offset: offset, rate: rate, Calc: CalcSkill}})
+	}
+
+	return players, nil
+}
+
+func WritePlayersCSV(path string, players []Player) error {
+	//The columns LoadPlayersCSV reads, so a population can be saved and played again
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	err = writer.Write([]string{"Id", "Skill Max", "Skill Offset", "Skill Rate", "Games Per Season", "Rank"})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(players); i++ {
+		p := &players[i]
+		//Shortest exact form, so skills read back unchanged
+		err = writer.Write([]string{strconv.Itoa(p.Id), strconv.FormatFloat(p.Skill.max, 'g', -1, 64), strconv.Itoa(p.Skill.offset), strconv.FormatFloat(p.Skill.rate, 'g', -1, 64), strconv.Itoa(p.GamesPerSeason), strconv.Itoa(p.Rank)})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (skill Skill) GobEncode() ([]byte, error) {
+	//gob skips unexported fields, so they're written out one by one. Calc is left for LoadState.
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	for _, value := range []interface{}{skill.max, skill.offset, skill.rate, skill.mode, skill.curve, skill.floor, skill.second} {
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (skill *Skill) GobDecode(data []byte) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	for _, value := range []interface{}{&skill.max, &skill.offset, &skill.rate, &skill.mode, &skill.curve, &skill.floor, &skill.second} {
+		if err := decoder.Decode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (glicko Glicko) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	for _, value := range []interface{}{glicko.rating, glicko.deviation, glicko.volatility, glicko.vInverse, glicko.improvement} {
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (glicko *Glicko) GobDecode(data []byte) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	for _, value := range []interface{}{&glicko.rating, &glicko.deviation, &glicko.volatility, &glicko.vInverse, &glicko.improvement} {
+		if err := decoder.Decode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func proRating(config *Config) func(p *Player) float64 {
+	//Hidden ratings reflect how players performed. With "pieces" there's none, so it falls back on true skill, which isn't fMMR but gets the top skilled.
+	if config.RatingSystem == "mmr" {
+		return func(p *Player) float64 { return p.MMR }
+	} else if config.RatingSystem == "elo" {
+		return func(p *Player) float64 { return p.EloRating }
+	} else if config.RatingSystem == "glicko" {
+		return func(p *Player) float64 { return p.Glicko.rating }
+	}
+	return func(p *Player) float64 { return p.Skill.Calc(&p.Skill, p.GamesPlayed) }
+}
+
+func proRankCutoff(players []*Player, topN int, rating func(p *Player) float64) float64 {
+	//Rating of the topNth best player. 0 when there aren't more than topN, so everyone makes the cut. Sorts players.
+	if len(players) <= topN {
+		return 0
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return rating(players[i]) > rating(players[j])
+	})
+	return rating(players[topN-1])
+}
+
+func timeToProStats(players []Player) {
+	games := make([]int, 0)
+	seasons := make([]int, 0)
+	for i := 0; i < len(players); i++ {
+		//Players can't progress past Pro Rank, so reaching it is always the last entry
+		progression := players[i].RankProgression[len(players[i].RankProgression)-1]
+		if progression.Rank == 0 {
+			games = append(games, progression.GamesPlayed)
+			seasons = append(seasons, progression.Season-players[i].JoinedSeason+1)
+		}
+	}
+
+	if len(games) == 0 {
+		log.Println("No players reached Pro Rank")
+		return
+	}
+
+	sort.Ints(games)
+	sort.Ints(seasons)
+	log.Println(len(games), "players reached Pro Rank. Median GamesToPro:", games[len(games)/2], "\tMedian SeasonsToPro:", seasons[len(seasons)/2])
+
+	binSize := 100
+	for bin := 0; bin <= games[len(games)-1]/binSize; bin++ {
+		cnt := 0
+		for i := 0; i < len(games); i++ {
+			if games[i]/binSize == bin {
+				cnt++
+			}
+		}
+		log.Println("GamesToPro", bin*binSize, "-", (bin+1)*binSize-1, "\tPlayers:", cnt)
+	}
+}
+
+func rankShares(players []Player, config *Config) []float64 {
+	shares := make([]float64, config.MaxRank+1)
+	count := 0
+	for i := 0; i < len(players); i++ {
+		if !players[i].Retired {
+			shares[players[i].Rank]++
+			count++
+		}
+	}
+	for r := 0; r < len(shares) && count > 0; r++ {
+		shares[r] /= float64(count)
+	}
+	return shares
+}
+
+func equilibriumSeason(summaries []SeasonSummary, tolerance float64) (int, float64) {
+	//First season whose rank shares all moved less than tolerance from the season before, -1 if none did. Also returns the largest move that season.
+	for i := 1; i < len(summaries); i++ {
+		largest := 0.0
+		for r := 0; r < len(summaries[i].RankShares) && r < len(summaries[i-1].RankShares); r++ {
+			largest = math.Max(largest, math.Abs(summaries[i].RankShares[r]-summaries[i-1].RankShares[r]))
+		}
+		if largest < tolerance {
+			return summaries[i].Season, largest
+		}
+	}
+	return -1, 0
+}
+
+func printReport(summaries []SeasonSummary, config *Config) {
+	if len(summaries) == 0 {
+		return
+	}
+
+	matches := 0
+	firstCutOff := 0.0
+	ragequits := make([]int, 0)
+	var matchingTime time.Duration
+	for i := 0; i < len(summaries); i++ {
+		matches += summaries[i].Matches
+		matchingTime += summaries[i].MatchingTime
+		ragequits = append(ragequits, summaries[i].Ragequits)
+		if firstCutOff == 0 {
+			firstCutOff = summaries[i].ProCutOff
+		}
+	}
+	last := summaries[len(summaries)-1]
+
+	//The cutoff stays 0 until Pro Rank overflows its leaderboard
+	trend := "n/a"
+	if firstCutOff != 0 {
+		if last.ProCutOff > firstCutOff {
+			trend = "up"
+		} else if last.ProCutOff < firstCutOff {
+			trend = "down"
+		} else {
+			trend = "flat"
+		}
+	}
+
+	fmt.Println("Seasons played:", len(summaries))
+	fmt.Println("Total players:", last.Players)
+	fmt.Println("Total matches:", matches)
+	fmt.Printf("Matches per second: %.0f (%s matchmaking)\n", float64(matches)/math.Max(matchingTime.Seconds(), 1e-9), matchingTime.Round(time.Millisecond))
+	fmt.Println("Final active players:", last.ActivePlayers)
+	fmt.Printf("Pro cutoff trend: %s (%f -> %f)\n", trend, firstCutOff, last.ProCutOff)
+	if season, change := equilibriumSeason(summaries, config.EquilibriumTolerance); season >= 0 {
+		fmt.Printf("Equilibrium season: %d (rank shares moved at most %f)\n", season, change)
+	} else {
+		fmt.Printf("Equilibrium season: not reached (no season's rank shares moved less than %f)\n", config.EquilibriumTolerance)
+	}
+	//To compare sweeps of -failed-matchmaking
+	fmt.Printf("Ragequits per season at FailedMatchMaking %d: %v\n", config.FailedMatchMaking, ragequits)
+}
+
+func playDeferredGames(players []Player, rng *rand.Rand, config *Config) {
+	//Deferred games are played against the average skill of the player's rank at the end of the season
+	rankSkill := make([]float64, config.MaxRank+1)
+	rankCount := make([]int, config.MaxRank+1)
+	for i := 0; i < len(players); i++ {
+		rankSkill[players[i].Rank] += players[i].Skill.Calc(&players[i].Skill, players[i].GamesPlayed)
+		rankCount[players[i].Rank]++
+	}
+	for r := 0; r < len(rankSkill); r++ {
+		if rankCount[r] > 0 {
+			rankSkill[r] /= float64(rankCount[r])
+		}
+	}
+
+	for i := 0; i < len(players); i++ {
+		p := &players[i]
+		p.GamesLeft += p.DeferredGames
+		p.DeferredGames = 0
+
+		for p.GamesLeft > 0 {
+			//ProRank players don't need to progress in this model, just end their season. Skipped games don't count towards GamesPlayed.
+			if p.Rank == 0 {
+				p.GamesLeft = 0
+				break
+			}
+
+			skill := p.Skill.Calc(&p.Skill, p.GamesPlayed)
+			opponentSkill := skill
+			if rankCount[p.Rank] > 0 {
+				opponentSkill = rankSkill[p.Rank]
+			}
+
+			if config.DrawProbability > 0 && rng.Float64() < config.DrawProbability {
+				addDraw(p, config)
+			} else if rng.Float64() < winProbability(skill, opponentSkill, config) {
+				addWin(p, config)
+			} else {
+				addLoss(p, config)
+			}
+		}
+	}
+}
+
+func endStats(p *[]Player, season int, stats *SeasonStats, config *Config) SeasonResult {
+	playersBR := make([][]int, config.MaxRank+1)
+	for i := 0; i < len(*p); i++ {
+		playersBR[(*p)[i].Rank] = append(playersBR[(*p)[i].Rank], i)
+	}
+
+	result := SeasonResult{Season: season, TotalPlayers: len(*p), PlayersSittingOut: len(*p) - stats.ActivePlayers, Ranks: make([]RankStat, 0)}
+	if config.TransitionMatrix {
+		result.Transitions = stats.Transitions
+	}
+
+	//Nobody played, so every rank would just be NaNs. Leave the rankings empty.
+	if stats.ActivePlayers == 0 {
+		log.Println("Season", season, "has no active players, skipping rankings")
+		return result
+	}
+
+	log.Println("Season", season, "Rankings:")
+
+	//Games it took to first reach each rank, over everyone that has ever got there
+	gamesToReachBR := make([][]int, config.MaxRank+1)
+	for i := 0; i < len(*p); i++ {
+		reached := gamesToReach(&(*p)[i])
+		for r, games := range reached {
+			gamesToReachBR[r] = append(gamesToReachBR[r], games)
+		}
+	}
+
+	//Games spent climbing out of each rank, to compare tiers that need different pieces
+	gamesInRankBR := make([][]int, config.MaxRank+1)
+	for i := 0; i < len(*p) && len(config.RankPieces) > 0; i++ {
+		reached := gamesToReach(&(*p)[i])
+		for r := 1; r <= config.MaxRank; r++ {
+			start, ok := reached[r]
+			end, passed := reached[r-1]
+			if ok && passed {
+				gamesInRankBR[r] = append(gamesInRankBR[r], end-start)
+			}
+		}
+	}
+
+	impliedRanks := make([]int, 0)
+	if config.RatingSystem == "mmr" {
+		impliedRanks = mmrImpliedRanks(*p)
+	}
+
+	//Where players that finished calibration this season were placed
+	placementsBR := make([]int, config.MaxRank+1)
+	for i := 0; i < len(*p) && config.CalibrationGames > 0; i++ {
+		if !(*p)[i].Calibrating && (*p)[i].PlacementSeason == season {
+			placementsBR[(*p)[i].PlacementRank]++
+		}
+	}
+
+	//Games it took smurfs to first get past each rank, which is reaching the one below it
+	smurfEscapesBR := make([][]int, config.MaxRank+1)
+	for i := 0; i < len(*p) && config.SmurfRate > 0; i++ {
+		if !(*p)[i].Smurf {
+			continue
+		}
+		reached := gamesToReach(&(*p)[i])
+		for r := 1; r <= config.MaxRank; r++ {
+			games, ok := reached[r-1]
+			if ok {
+				smurfEscapesBR[r] = append(smurfEscapesBR[r], games)
+			}
+		}
+	}
+
+	for r := 0; r < len(playersBR); r++ {
+		gp := 0
+		avg := 0.0
+		m2 := 0.0
+		gpAll := 0
+		cnt := len(playersBR[r])
+		cntAll := 0
+		pieces := 0
+		piecesEarned := 0
+		piecesLost := 0
+		winRate := 0.0
+		drawRate := 0.0
+		winRateCnt := 0
+		elo := 0.0
+		glickoRating := 0.0
+		glickoDeviation := 0.0
+		mmr := 0.0
+		mmrRankGap := 0
+		smurfs := 0
+		skills := make([]float64, cnt)
+
+		for i := 0; i < cnt; i++ {
+			if (*p)[playersBR[r][i]].Smurf {
+				smurfs++
+			}
+			elo += (*p)[playersBR[r][i]].EloRating
+			glickoRating += (*p)[playersBR[r][i]].Glicko.rating
+			glickoDeviation += (*p)[playersBR[r][i]].Glicko.deviation
+			if config.RatingSystem == "mmr" {
+				mmr += (*p)[playersBR[r][i]].MMR
+				mmrRankGap += int(math.Abs(float64(impliedRanks[playersBR[r][i]] - r)))
+			}
+			gp += (*p)[playersBR[r][i]].GamesPlayed
+			//Rates are over matches actually played
+			matches := (*p)[playersBR[r][i]].Wins + (*p)[playersBR[r][i]].Losses + (*p)[playersBR[r][i]].Draws
+			if matches > 0 {
+				winRate += float64((*p)[playersBR[r][i]].Wins) / float64(matches)
+				drawRate += float64((*p)[playersBR[r][i]].Draws) / float64(matches)
+				winRateCnt++
+			}
+			pieces += (*p)[playersBR[r][i]].Pieces
+			piecesEarned += (*p)[playersBR[r][i]].PiecesEarned
+			piecesLost += (*p)[playersBR[r][i]].PiecesLost
+			//Welford's running mean and variance, so each player's skill is only calculated once
+			pSkill := &(*p)[playersBR[r][i]].Skill
+			skill := (*p)[playersBR[r][i]].Skill.Calc(pSkill, (*p)[playersBR[r][i]].GamesPlayed)
+			if config.SkillDimensions {
+				//Players are on the play half the time
+				skill = (roleSkill(pSkill, skill, true, config) + roleSkill(pSkill, skill, false, config)) / 2
+			}
+			skills[i] = skill
+			delta := skill - avg
+			avg += delta / float64(i+1)
+			m2 += delta * (skill - avg)
+		}
+
+		sort.Float64s(skills)
+
+		//Summary mode only keeps the latest progression, so there's no history to count players who already passed this rank
+		for rp := r - 1; rp >= 0 && config.RankProgressionMode == "full"; rp-- {
+			for i := 0; i < len(playersBR[rp]); i++ {
+				//Passing this rank is reaching the one below it. Players without that entry are skipped rather than read out of bounds.
+				progression, ok := progressionAt(&(*p)[playersBR[rp][i]], r-1)
+				if ok {
+					cntAll++
+					gpAll += progression.GamesPlayed - 1
+				}
+			}
+		}
+
+		//Match stats don't depend on who finished here, so every rank gets them
+		rankStat := RankStat{Rank: r, FavoriteWinRate: ratio(stats.FavoriteWins[r], stats.FavoriteMatches[r]), UpsetRate: ratio(stats.FavoriteMatches[r]-stats.FavoriteWins[r], stats.FavoriteMatches[r]), Retention: ratio(stats.Retained[r], stats.LastSeasonPlayers[r]), NewcomerWinRate: ratio(stats.NewcomerWins[r], stats.NewcomerMatches[r]), Ragequits: stats.Ragequits[r]}
+		if stats.Ragequits[r] > 0 {
+			log.Println("Rank", r, "\tRagequits:", stats.Ragequits[r])
+		}
+		if len(gamesToReachBR[r]) > 0 {
+			sort.Ints(gamesToReachBR[r])
+			medianGames := median(gamesToReachBR[r])
+			p90Games := percentile(gamesToReachBR[r], 0.9)
+			log.Println("Rank", r, "\tReached:", len(gamesToReachBR[r]), "\tMedianGamesToReach:", medianGames, "\tP90GamesToReach:", p90Games)
+			rankStat.MedianGamesToReach = &medianGames
+			rankStat.P90GamesToReach = &p90Games
+		}
+		if len(config.RankPieces) > 0 && r > 0 {
+			rankStat.PiecesToLeave = piecesToLeave(r, config)
+			if len(gamesInRankBR[r]) > 0 {
+				sort.Ints(gamesInRankBR[r])
+				medianGamesInRank := median(gamesInRankBR[r])
+				log.Println("Rank", r, "\tPiecesToLeave:", rankStat.PiecesToLeave, "\tMedianGamesInRank:", medianGamesInRank)
+				rankStat.MedianGamesInRank = &medianGamesInRank
+			}
+		}
+		if len(stats.SkillGaps[r]) > 0 {
+			avgSkillGap, p95SkillGap := skillGapStats(stats.SkillGaps[r])
+			log.Println("Rank", r, "\tAverageSkillGap:", avgSkillGap, "\tP95SkillGap:", p95SkillGap)
+			rankStat.AvgSkillGap = &avgSkillGap
+			rankStat.P95SkillGap = &p95SkillGap
+		}
+		if rankStat.UpsetRate != nil {
+			log.Println("Rank", r, "\tUpsetRate:", *rankStat.UpsetRate)
+		}
+		if config.ChurnProbability > 0 {
+			rankStat.ChurnRate = ratio(stats.Churned[r], stats.LastSeasonPlayers[r])
+		}
+		if config.QueueExpansion > 0 && len(stats.QueueTimes[r]) > 0 {
+			avgQueueTime, p95QueueTime := queueTimeStats(stats.QueueTimes[r])
+			log.Println("Rank", r, "\tAverageQueueTime:", avgQueueTime, "\tP95QueueTime:", p95QueueTime)
+			rankStat.AvgQueueTime = &avgQueueTime
+			rankStat.P95QueueTime = &p95QueueTime
+		}
+
+		if config.CalibrationGames > 0 {
+			rankStat.Placements = placementsBR[r]
+			log.Println("Rank", r, "\tPlacements:", placementsBR[r])
+		}
+		if config.SmurfRate > 0 {
+			rankStat.SmurfCount = smurfs
+			if len(smurfEscapesBR[r]) > 0 {
+				total := 0
+				for i := 0; i < len(smurfEscapesBR[r]); i++ {
+					total += smurfEscapesBR[r][i]
+				}
+				smurfGamesToEscape := float64(total) / float64(len(smurfEscapesBR[r]))
+				rankStat.SmurfGamesToEscape = &smurfGamesToEscape
+			}
+			log.Println("Rank", r, "\tSmurfs:", smurfs, "\tSmurfGamesToEscape:", formatRate(rankStat.SmurfGamesToEscape))
+		}
+
+		if cnt > 0 {
+			//Averages over the rank's players, an empty rank has none
+			stddev := math.Sqrt(m2 / float64(cnt))
+			elo /= float64(cnt)
+			glickoRating /= float64(cnt)
+			glickoDeviation /= float64(cnt)
+			//Players who only sat out have no rate, so a rank of them has none either
+			if winRateCnt > 0 {
+				winRate /= float64(winRateCnt)
+				drawRate /= float64(winRateCnt)
+				rankStat.AvgWinRate = &winRate
+				rankStat.AvgDrawRate = &drawRate
+			}
+
+			if r > 0 {
+				log.Println("Rank", r, "\tPlayers:", cnt, "\tGamesPlayed:", gp/cnt, "\tSkill:", avg, "\tMedianSkill:", medianFloat(skills), "\tStdDev:", stddev, "\tSkillGini:", giniCoefficient(skills), "\tGamesToProgressPastRank:", (gp+gpAll)/(cnt+cntAll), "\tFavoriteWinRate:", formatRate(rankStat.FavoriteWinRate), "\tPieces:", float64(pieces)/float64(cnt), "\tPiecesEarned:", piecesEarned, "\tPiecesLost:", piecesLost, "\tWinRate:", formatRate(rankStat.AvgWinRate), "\tDrawRate:", formatRate(rankStat.AvgDrawRate))
+			} else {
+				log.Println("Rank", r, "\tPlayers:", cnt, "\tGamesPlayed:", gp/cnt, "\tSkill:", avg, "\tMedianSkill:", medianFloat(skills), "\tStdDev:", stddev, "\tSkillGini:", giniCoefficient(skills), "\tFavoriteWinRate:", formatRate(rankStat.FavoriteWinRate), "\tPieces:", float64(pieces)/float64(cnt), "\tPiecesEarned:", piecesEarned, "\tPiecesLost:", piecesLost, "\tWinRate:", formatRate(rankStat.AvgWinRate), "\tDrawRate:", formatRate(rankStat.AvgDrawRate))
+			}
+
+			rankStat.PlayerCount = cnt
+			rankStat.AvgGamesPlayed = float64(gp) / float64(cnt)
+			rankStat.AvgSkill = avg
+			rankStat.MedianSkill = medianFloat(skills)
+			rankStat.StdDev = stddev
+			rankStat.SkillGini = giniCoefficient(skills)
+			rankStat.AvgPieces = float64(pieces) / float64(cnt)
+			rankStat.PiecesEarned = piecesEarned
+			rankStat.PiecesLost = piecesLost
+			if r > 0 {
+				rankStat.AvgProgressionCount = float64(gp+gpAll) / float64(cnt+cntAll)
+			}
+			if config.RatingSystem == "elo" {
+				log.Println("Rank", r, "\tElo:", elo)
+				rankStat.AvgElo = elo
+			} else if config.RatingSystem == "glicko" {
+				log.Println("Rank", r, "\tGlickoRating:", glickoRating, "\tGlickoDeviation:", glickoDeviation)
+				rankStat.AvgGlickoRating = glickoRating
+				rankStat.AvgGlickoDeviation = glickoDeviation
+			} else if config.RatingSystem == "mmr" {
+				log.Println("Rank", r, "\tMMR:", mmr/float64(cnt), "\tMMRRankGap:", float64(mmrRankGap)/float64(cnt))
+				rankStat.AvgMMR = mmr / float64(cnt)
+				rankStat.AvgMMRRankGap = float64(mmrRankGap) / float64(cnt)
+			}
+			result.Ranks = append(result.Ranks, rankStat)
+		} else {
+			log.Println("Rank", r, "\tPlayers: 0 \tGamesPlayed: 0 \tSkill: n/a \tStdDev: n/a \tGamesToProgress: n/a")
+
+			//Keep one entry per rank so the rankings have the same shape every season
+			result.Ranks = append(result.Ranks, rankStat)
+		}
+	}
+
+	favoriteWins := 0
+	favoriteMatches := 0
+	for r := 0; r < len(stats.FavoriteMatches); r++ {
+		favoriteWins += stats.FavoriteWins[r]
+		favoriteMatches += stats.FavoriteMatches[r]
+	}
+	log.Println("Season", season, "FavoriteWinRate:", formatRate(ratio(favoriteWins, favoriteMatches)))
+
+	newcomerWins := 0
+	newcomerMatches := 0
+	for r := 0; r < len(stats.NewcomerMatches); r++ {
+		newcomerWins += stats.NewcomerWins[r]
+		newcomerMatches += stats.NewcomerMatches[r]
+	}
+	log.Println("Season", season, "NewcomerMatches:", newcomerMatches, "\tNewcomerWinRate:", formatRate(ratio(newcomerWins, newcomerMatches)))
+
+	ragequits := 0
+	for r := 0; r < len(stats.Ragequits); r++ {
+		ragequits += stats.Ragequits[r]
+	}
+	log.Println("Season", season, "Ragequits:", ragequits)
+
+	if config.CoinFlipAdvantage > 0 || config.SkillDimensions {
+		result.FirstWinRate = ratio(stats.FirstPlayerWins, stats.FirstPlayerMatches)
+		log.Println("Season", season, "FirstPlayerMatches:", stats.FirstPlayerMatches, "\tFirstPlayerWinRate:", formatRate(result.FirstWinRate))
+	}
+
+	if config.FactionCount > 1 {
+		result.FactionWinRates = make([]*float64, config.FactionCount)
+		for f := 0; f < config.FactionCount; f++ {
+			result.FactionWinRates[f] = ratio(stats.FactionWins[f], stats.FactionMatches[f])
+			log.Println("Season", season, "Faction", f, "\tMatches:", stats.FactionMatches[f], "\tWinRate:", formatRate(result.FactionWinRates[f]))
+		}
+	}
+
+	result.ResetRanks = stats.ResetRanks
+	if season > 0 {
+		log.Println("Season", season, "ResetRanks:", stats.ResetRanks)
+	}
+
+	//Retention is keyed on last season's ranks, so it's logged apart from this season's rankings
+	for r := 0; r < len(stats.LastSeasonPlayers); r++ {
+		if stats.LastSeasonPlayers[r] > 0 {
+			log.Println("Season", season, "Rank", r, "\tLastSeasonPlayers:", stats.LastSeasonPlayers[r], "\tRetention:", float64(stats.Retained[r])/float64(stats.LastSeasonPlayers[r]), "\tChurned:", stats.Churned[r])
+		}
+	}
+
+	return result
+}
+
+func correlation(xs []float64, ys []float64) float64 {
+	//Pearson's r, 0 when either side doesn't vary
+	n := float64(len(xs))
+	if n == 0 {
+		return 0
+	}
+	xMean := 0.0
+	yMean := 0.0
+	for i := 0; i < len(xs); i++ {
+		xMean += xs[i] / n
+		yMean += ys[i] / n
+	}
+
+	covariance := 0.0
+	xVariance := 0.0
+	yVariance := 0.0
+	for i := 0; i < len(xs); i++ {
+		covariance += (xs[i] - xMean) * (ys[i] - yMean)
+		xVariance += (xs[i] - xMean) * (xs[i] - xMean)
+		yVariance += (ys[i] - yMean) * (ys[i] - yMean)
+	}
+	if xVariance == 0 || yVariance == 0 {
+		return 0
+	}
+	return covariance / math.Sqrt(xVariance*yVariance)
+}
+
+func giniCoefficient(values []float64) float64 {
+	//0 when every value is the same, approaching 1 as one value holds everything. Values should be >= 0.
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	total := 0.0
+	weighted := 0.0
+	for i := 0; i < len(sorted); i++ {
+		total += sorted[i]
+		weighted += float64(i+1) * sorted[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	n := float64(len(sorted))
+	return 2*weighted/(n*total) - (n+1)/n
+}
+
+func mmrImpliedRanks(players []Player) []int {
+	//The player with the nth highest MMR gets the nth best rank on the ladder, so the implied ladder has the same shape as the real one
+	byMMR := make([]int, len(players))
+	ranks := make([]int, len(players))
+	for i := 0; i < len(players); i++ {
+		byMMR[i] = i
+		ranks[i] = players[i].Rank
+	}
+	sort.Slice(byMMR, func(i, j int) bool {
+		return players[byMMR[i]].MMR > players[byMMR[j]].MMR
+	})
+	sort.Ints(ranks)
+
+	implied := make([]int, len(players))
+	for i := 0; i < len(byMMR); i++ {
+		implied[byMMR[i]] = ranks[i]
+	}
+	return implied
+}
+
+func queueTimeStats(queueTimes []int) (float64, float64) {
+	//Average and 95th percentile
+	sorted := make([]int, len(queueTimes))
+	copy(sorted, queueTimes)
+	sort.Ints(sorted)
+
+	total := 0
+	for i := 0; i < len(sorted); i++ {
+		total += sorted[i]
+	}
+
+	return float64(total) / float64(len(sorted)), percentile(sorted, 0.95)
+}
+
+func skillGapStats(skillGaps []float64) (float64, float64) {
+	//Average and 95th percentile, by nearest rank
+	sorted := make([]float64, len(skillGaps))
+	copy(sorted, skillGaps)
+	sort.Float64s(sorted)
+
+	total := 0.0
+	for i := 0; i < len(sorted); i++ {
+		total += sorted[i]
+	}
+
+	return total / float64(len(sorted)), sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+}
+
+func progressionAt(player *Player, rank int) (RankProgression, bool) {
+	//Looked up by Rank, not position, since a player's progression doesn't have to start at MaxRank
+	for i := 0; i < len(player.RankProgression); i++ {
+		if player.RankProgression[i].Rank == rank {
+			return player.RankProgression[i], true
+		}
+	}
+	return RankProgression{}, false
+}
+
+func gamesToReach(player *Player) map[int]int {
+	//Rank to games played when the player first reached it. The rank a player started at, and any above it, count as reached at 0 games.
+	reached := make(map[int]int)
+	for i := 0; i < len(player.RankProgression); i++ {
+		if _, ok := reached[player.RankProgression[i].Rank]; !ok {
+			reached[player.RankProgression[i].Rank] = player.RankProgression[i].GamesPlayed
+		}
+	}
+	return reached
+}
+
+func median(sorted []int) float64 {
+	n := len(sorted)
+	if n%2 == 0 {
+		return float64(sorted[n/2-1]+sorted[n/2]) / 2
+	}
+	return float64(sorted[n/2])
+}
+
+func medianFloat(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
+
+func percentile(sorted []int, p float64) float64 {
+	//Nearest rank
+	return float64(sorted[int(math.Ceil(p*float64(len(sorted))))-1])
+}
+
+func ratio(numerator int, denominator int) *float64 {
+	//nil rather than NaN when there's nothing to take a rate of, NaN can't be written as JSON
+	if denominator == 0 {
+		return nil
+	}
+	rate := float64(numerator) / float64(denominator)
+	return &rate
+}
+
+func outputName(config *Config) string {
+	fileName := ""
+	if config.Derank {
+		fileName += "Derank"
+	} else {
+		fileName += "NoDerank"
+	}
+	if config.Learn {
+		fileName += "Learn"
+	} else {
+		fileName += "NoLearn"
+	}
+	return filepath.Join(config.OutputDir, fileName)
+}
+
+func writeSeasonResult(result SeasonResult, config *Config) {
+	fileName := outputName(config)
+	if config.PerSeasonOutput {
+		fileName += strconv.Itoa(result.Season)
+	}
+
+	if config.OutputFormat == "json" {
+		writeJSON(fileName+".json", result)
+		return
+	}
+
+	file, err := os.Create(fileName + ".csv")
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	err = writer.Write(csvHeader(config))
+	checkError("Cannot write to file", err)
+
+	for i := 0; i < len(result.Ranks); i++ {
+		err = writer.Write(rankStatRow(result.Ranks[i], config))
+		checkError("Cannot write to file", err)
+	}
+}
+
+func writeTransitions(result SeasonResult, config *Config) {
+	//A grid with the rank a player started the season at down the side and the rank they finished at across the top
+	if !config.TransitionMatrix || config.OutputFormat != "csv" {
+		return
+	}
+	fileName := outputName(config) + "Transitions"
+	if config.PerSeasonOutput {
+		fileName += strconv.Itoa(result.Season)
+	}
+
+	file, err := os.Create(fileName + ".csv")
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"From \\ To"}
+	for r := 0; r < len(result.Transitions); r++ {
+		header = append(header, strconv.Itoa(r))
+	}
+	err = writer.Write(header)
+	checkError("Cannot write to file", err)
+
+	for from := 0; from < len(result.Transitions); from++ {
+		row := []string{strconv.Itoa(from)}
+		for to := 0; to < len(result.Transitions[from]); to++ {
+			row = append(row, strconv.Itoa(result.Transitions[from][to]))
+		}
+		err = writer.Write(row)
+		checkError("Cannot write to file", err)
+	}
+}
+
+func writeLeaderboard(players []Player, season int, config *Config) {
+	//Individual players rather than rank averages, best first. Retired players are off the ladder.
+	if config.LeaderboardSize == 0 || config.OutputFormat != "csv" {
+		return
+	}
+	fileName := outputName(config) + "Leaderboard"
+	if config.LeaderboardEverySeason {
+		fileName += strconv.Itoa(season)
+	}
+
+	rating := proRating(config)
+	ranked := make([]*Player, 0)
+	for i := 0; i < len(players); i++ {
+		if !players[i].Retired {
+			ranked = append(ranked, &players[i])
+		}
+	}
+	//Stable, so ties stay in Id order
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return rating(ranked[i]) > rating(ranked[j])
+	})
+
+	file, err := os.Create(fileName + ".csv")
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	err = writer.Write([]string{"Place", "Id", "Rank", "Games Played", "Rating"})
+	checkError("Cannot write to file", err)
+
+	for i := 0; i < len(ranked) && i < config.LeaderboardSize; i++ {
+		err = writer.Write([]string{strconv.Itoa(i + 1), strconv.Itoa(ranked[i].Id), strconv.Itoa(ranked[i].Rank), strconv.Itoa(ranked[i].GamesPlayed), fmt.Sprintf("%f", rating(ranked[i]))})
+		checkError("Cannot write to file", err)
+	}
+}
+
+func traceEvent(trace *csv.Writer, p *Player, event string) {
+	err := trace.Write([]string{strconv.Itoa(p.Season), event, strconv.Itoa(p.Rank), strconv.Itoa(p.Pieces), strconv.Itoa(p.GamesPlayed)})
+	checkError("Cannot write to file", err)
+}
+
+func traceRankChange(trace *csv.Writer, players []Player, lastRank *int, config *Config) {
+	//The traced player may not have joined yet, and retired players are off the ladder
+	if trace == nil || config.TracePlayer >= len(players) || players[config.TracePlayer].Retired || players[config.TracePlayer].Rank == *lastRank {
+		return
+	}
+	p := &players[config.TracePlayer]
+	event := "Rank Up"
+	if p.Rank > *lastRank {
+		event = "Rank Down"
+	}
+	*lastRank = p.Rank
+	traceEvent(trace, p, event)
+}
+
+func streamSeasonResult(writer *csv.Writer, result SeasonResult, config *Config) {
+	for i := 0; i < len(result.Ranks); i++ {
+		err := writer.Write(append([]string{strconv.Itoa(result.Season)}, rankStatRow(result.Ranks[i], config)...))
+		checkError("Cannot write to file", err)
+	}
+	writer.Flush()
+	checkError("Cannot write to file", writer.Error())
+}
+
+func csvHeader(config *Config) []string {
+	header := []string{"Rank", "Player Count", "Average Games Played", "Average Skill", "Median Skill", "Std Dev", "Average Progression Count", "Favorite Win Rate", "Average Pieces", "Pieces Earned", "Pieces Lost", "Retention From Last Season", "Newcomer Win Rate", "Average Win Rate", "Average Draw Rate", "Median Games To Reach", "P90 Games To Reach", "Ragequits", "Skill Gini", "Average Skill Gap", "P95 Skill Gap", "Upset Rate"}
+	if config.ChurnProbability > 0 {
+		header = append(header, "Churn Rate")
+	}
+	if config.QueueExpansion > 0 {
+		header = append(header, "Average Queue Time", "P95 Queue Time")
+	}
+	if config.SmurfRate > 0 {
+		header = append(header, "Smurfs", "Smurf Games To Escape")
+	}
+	if config.CalibrationGames > 0 {
+		header = append(header, "Placements")
+	}
+	if len(config.RankPieces) > 0 {
+		header = append(header, "Pieces To Leave", "Median Games In Rank")
+	}
+	if config.RatingSystem == "elo" {
+		header = append(header, "Average Elo")
+	} else if config.RatingSystem == "glicko" {
+		header = append(header, "Average Glicko Rating", "Average Glicko Deviation")
+	} else if config.RatingSystem == "mmr" {
+		header = append(header, "Average MMR", "Average MMR Rank Gap")
+	}
+	return header
+}
+
+func piecesToLeaveCell(stat RankStat) string {
+	//There's no leaving Pro Rank
+	if stat.Rank == 0 {
+		return ""
+	}
+	return strconv.Itoa(stat.PiecesToLeave)
+}
+
+func rankStatRow(stat RankStat, config *Config) []string {
+	//Empty ranks get blank cells for everything averaged over players. Match stats don't depend on who finished here.
+	if stat.PlayerCount == 0 {
+		row := []string{strconv.Itoa(stat.Rank), "0", "", "", "", "", "", formatRate(stat.FavoriteWinRate), "", "0", "0", formatRate(stat.Retention), formatRate(stat.NewcomerWinRate), "", "", formatRate(stat.MedianGamesToReach), formatRate(stat.P90GamesToReach), strconv.Itoa(stat.Ragequits), "", formatRate(stat.AvgSkillGap), formatRate(stat.P95SkillGap), formatRate(stat.UpsetRate)}
+		if config.ChurnProbability > 0 {
+			row = append(row, formatRate(stat.ChurnRate))
+		}
+		if config.QueueExpansion > 0 {
+			row = append(row, formatRate(stat.AvgQueueTime), formatRate(stat.P95QueueTime))
+		}
+		if config.SmurfRate > 0 {
+			row = append(row, "0", formatRate(stat.SmurfGamesToEscape))
+		}
+		if config.CalibrationGames > 0 {
+			row = append(row, strconv.Itoa(stat.Placements))
+		}
+		if len(config.RankPieces) > 0 {
+			row = append(row, piecesToLeaveCell(stat), formatRate(stat.MedianGamesInRank))
+		}
+		if config.RatingSystem == "elo" {
+			row = append(row, "")
+		} else if config.RatingSystem == "glicko" {
+			row = append(row, "", "")
+		} else if config.RatingSystem == "mmr" {
+			row = append(row, "", "")
+		}
+		return row
+	}
+
+	//Nothing to progress past at Pro Rank
+	progression := ""
+	if stat.Rank > 0 {
+		progression = fmt.Sprintf("%f", stat.AvgProgressionCount)
+	}
+
+	row := []string{strconv.Itoa(stat.Rank), strconv.Itoa(stat.PlayerCount), fmt.Sprintf("%f", stat.AvgGamesPlayed), fmt.Sprintf("%f", stat.AvgSkill), fmt.Sprintf("%f", stat.MedianSkill), fmt.Sprintf("%f", stat.StdDev), progression, formatRate(stat.FavoriteWinRate), fmt.Sprintf("%f", stat.AvgPieces), strconv.Itoa(stat.PiecesEarned), strconv.Itoa(stat.PiecesLost), formatRate(stat.Retention), formatRate(stat.NewcomerWinRate), formatRate(stat.AvgWinRate), formatRate(stat.AvgDrawRate), formatRate(stat.MedianGamesToReach), formatRate(stat.P90GamesToReach), strconv.Itoa(stat.Ragequits), fmt.Sprintf("%f", stat.SkillGini), formatRate(stat.AvgSkillGap), formatRate(stat.P95SkillGap), formatRate(stat.UpsetRate)}
+	if config.ChurnProbability > 0 {
+		row = append(row, formatRate(stat.ChurnRate))
+	}
+	if config.QueueExpansion > 0 {
+		row = append(row, formatRate(stat.AvgQueueTime), formatRate(stat.P95QueueTime))
+	}
+	if config.SmurfRate > 0 {
+		row = append(row, strconv.Itoa(stat.SmurfCount), formatRate(stat.SmurfGamesToEscape))
+	}
+	if config.CalibrationGames > 0 {
+		row = append(row, strconv.Itoa(stat.Placements))
+	}
+	if len(config.RankPieces) > 0 {
+		row = append(row, piecesToLeaveCell(stat), formatRate(stat.MedianGamesInRank))
+	}
+	if config.RatingSystem == "elo" {
+		row = append(row, fmt.Sprintf("%f", stat.AvgElo))
+	} else if config.RatingSystem == "glicko" {
+		row = append(row, fmt.Sprintf("%f", stat.AvgGlickoRating), fmt.Sprintf("%f", stat.AvgGlickoDeviation))
+	} else if config.RatingSystem == "mmr" {
+		row = append(row, fmt.Sprintf("%f", stat.AvgMMR), fmt.Sprintf("%f", stat.AvgMMRRankGap))
+	}
+	return row
+}
+
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return ""
+	}
+	return fmt.Sprintf("%f", *rate)
+}
+
+func writeJSON(fileName string, v interface{}) {
+	file, err := os.Create(fileName)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(v)
+	checkError("Cannot write to file", err)
+}
+
+func findOpponent(players []Player, playersWGBR [][]int, aRank int, aRankedIndex int, rng *rand.Rand, config *Config) (int, int, bool) {
+	aId := playersWGBR[aRank][aRankedIndex]
+	aSkill := players[aId].Skill.Calc(&players[aId].Skill, players[aId].GamesPlayed)
+
+	if config.MatchByMMR {
+		return closestMMR(players, playersWGBR, aId)
+	}
+
+	//The search widens the longer a has been waiting
+	if config.QueueExpansion > 0 {
+		return searchBand(players, playersWGBR, aRank, aRankedIndex, aSkill, config.MatchSearchWidth+players[aId].QueueTime*config.QueueExpansion, rng, config)
+	}
+
+	if config.MatchSearchWidth > 0 {
+		return searchBand(players, playersWGBR, aRank, aRankedIndex, aSkill, config.MatchSearchWidth, rng, config)
+	}
+
+	//Pick a random opponent from a's rank, excluding a
+	if len(playersWGBR[aRank]) > 1 {
+		if config.MatchBySkill {
+			bRankedIndex, _ := closestSkill(players, playersWGBR[aRank], aId, aSkill)
+			return aRank, bRankedIndex, true
+		}
+		bRankedIndex := int(rng.Float64() * float64(len(playersWGBR[aRank])-1))
+		if bRankedIndex >= aRankedIndex {
+			bRankedIndex++
+		}
+		return aRank, bRankedIndex, true
+	}
+
+	//If there aren't any other players in a's rank, search outward one rank at a time until we find anyone or run out of ladder
+	for d := 1; aRank-d >= 0 || aRank+d < len(playersWGBR); d++ {
+		above := 0
+		below := 0
+		if aRank+d < len(playersWGBR) {
+			above = len(playersWGBR[aRank+d])
+		}
+		if aRank-d >= 0 {
+			below = len(playersWGBR[aRank-d])
+		}
+
+		if above+below > 0 && config.MatchBySkill {
+			aboveIndex, aboveGap := -1, math.Inf(1)
+			if above > 0 {
+				aboveIndex, aboveGap = closestSkill(players, playersWGBR[aRank+d], aId, aSkill)
+			}
+			belowIndex, belowGap := -1, math.Inf(1)
+			if below > 0 {
+				belowIndex, belowGap = closestSkill(players, playersWGBR[aRank-d], aId, aSkill)
+			}
+			if aboveGap <= belowGap {
+				return aRank + d, aboveIndex, true
+			}
+			return aRank - d, belowIndex, true
+		}
+
+		if above+below > 0 {
+			bRankedIndex := int(rng.Float64() * float64(above+below))
+			if bRankedIndex < above {
+				return aRank + d, bRankedIndex, true
+			}
+			return aRank - d, bRankedIndex - above, true
+		}
+	}
+
+	return -1, -1, false
+}
+
+func searchBand(players []Player, playersWGBR [][]int, aRank int, aRankedIndex int, aSkill float64, width int, rng *rand.Rand, config *Config) (int, int, bool) {
+	//Everyone within width ranks of a is a candidate, clipped to the ladder
+	low := aRank - width
+	if low < 0 {
+		low = 0
+	}
+	high := aRank + width
+	if high > len(playersWGBR)-1 {
+		high = len(playersWGBR) - 1
+	}
+
+	if config.MatchBySkill {
+		bRank, bRankedIndex, gap := -1, -1, math.Inf(1)
+		for r := low; r <= high; r++ {
+			i, d := closestSkill(players, playersWGBR[r], playersWGBR[aRank][aRankedIndex], aSkill)
+			if i >= 0 && d < gap {
+				bRank, bRankedIndex, gap = r, i, d
+			}
+		}
+		return bRank, bRankedIndex, bRank >= 0
+	}
+
+	candidates := -1
+	for r := low; r <= high; r++ {
+		candidates += len(playersWGBR[r])
+	}
+	if candidates <= 0 {
+		return -1, -1, false
+	}
+
+	//Walk the band to the picked candidate, skipping over a
+	pick := int(rng.Float64() * float64(candidates))
+	for r := low; r <= high; r++ {
+		n := len(playersWGBR[r])
+		if r == aRank {
+			n--
+		}
+		if pick < n {
+			if r == aRank && pick >= aRankedIndex {
+				pick++
+			}
+			return r, pick, true
+		}
+		pick -= n
+	}
+
+	return -1, -1, false
+}
+
+func closestSkill(players []Player, pool []int, aId int, aSkill float64) (int, float64) {
+	//Index into pool of the player closest in skill to a, and how far off they are. -1 if a is the only one in the pool.
+	closest := -1
+	gap := math.Inf(1)
+	for i := 0; i < len(pool); i++ {
+		if pool[i] == aId {
+			continue
+		}
+		d := math.Abs(players[pool[i]].Skill.Calc(&players[pool[i]].Skill, players[pool[i]].GamesPlayed) - aSkill)
+		if d < gap {
+			closest = i
+			gap = d
+		}
+	}
+	return closest, gap
+}
+
+func closestMMR(players []Player, playersWGBR [][]int, aId int) (int, int, bool) {
+	//Rank and index into that rank of the player closest to a's MMR, anywhere on the ladder
+	closestRank := -1
+	closestIndex := -1
+	gap := math.Inf(1)
+	for r := 0; r < len(playersWGBR); r++ {
+		for i := 0; i < len(playersWGBR[r]); i++ {
+			if playersWGBR[r][i] == aId {
+				continue
+			}
+			d := math.Abs(players[playersWGBR[r][i]].MMR - players[aId].MMR)
+			if d < gap {
+				closestRank = r
+				closestIndex = i
+				gap = d
+			}
+		}
+	}
+	return closestRank, closestIndex, closestRank >= 0
+}
+
+func anyMatchable(playersWithGames []int, playersWGBR [][]int, config *Config) bool {
+	//Only a fixed MatchSearchWidth can strand players, every other search ends up reaching across the whole ladder
+	if config.MatchSearchWidth == 0 || config.QueueExpansion > 0 || config.MatchByMMR {
+		return true
+	}
+
+	//Party members aren't in the buckets, and they either play or break up back into them
+	queued := 0
+	for r := 0; r < len(playersWGBR); r++ {
+		queued += len(playersWGBR[r])
+	}
+	if queued < len(playersWithGames) {
+		return true
+	}
+
+	for r := 0; r < len(playersWGBR); r++ {
+		if len(playersWGBR[r]) == 0 {
+			continue
+		}
+		//Everyone in reach of rank r, less one for the player themselves
+		reachable := -1
+		for o := r - config.MatchSearchWidth; o <= r+config.MatchSearchWidth; o++ {
+			if o >= 0 && o < len(playersWGBR) {
+				reachable += len(playersWGBR[o])
+			}
+		}
+		if reachable > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func bucketViolations(players []Player, playersWithGames []int, playersWGBR [][]int) []string {
+	//Every queued player should be in the bucket for their rank exactly once, and nobody else should be in a bucket
+	violations := make([]string, 0)
+	withGames := make([]bool, len(players))
+	for i := 0; i < len(playersWithGames); i++ {
+		withGames[playersWithGames[i]] = true
+	}
+
+	bucketed := make([]int, len(players))
+	for r := 0; r < len(playersWGBR); r++ {
+		for i := 0; i < len(playersWGBR[r]); i++ {
+			id := playersWGBR[r][i]
+			bucketed[id]++
+			if players[id].Rank != r {
+				violations = append(violations, fmt.Sprintf("player %d is in rank %d's bucket at rank %d", id, r, players[id].Rank))
+			}
+			if !withGames[id] {
+				violations = append(violations, fmt.Sprintf("player %d is in rank %d's bucket with no games left", id, r))
+			}
+		}
+	}
+
+	//Party members are out of the buckets until their party breaks up
+	for i := 0; i < len(playersWithGames); i++ {
+		id := playersWithGames[i]
+		if players[id].Party < 0 && bucketed[id] != 1 {
+			violations = append(violations, fmt.Sprintf("player %d has games left and is in %d rank buckets", id, bucketed[id]))
+		}
+	}
+	return violations
+}
+
+func warnIfStarved(playersWGBR [][]int, rank int, matchesPlayed int, lastWarning []int, config *Config) {
+	if len(playersWGBR[rank]) > 1 || matchesPlayed-lastWarning[rank] < config.StarvationWarningInterval {
+		return
+	}
+
+	largestRank := 0
+	for r := 0; r < len(playersWGBR); r++ {
+		if len(playersWGBR[r]) > len(playersWGBR[largestRank]) {
+			largestRank = r
+		}
+	}
+
+	if len(playersWGBR[largestRank]) >= config.StarvationThreshold {
+		lastWarning[rank] = matchesPlayed
+		log.Println("Rank", rank, "is starved with", len(playersWGBR[rank]), "player(s) left after", matchesPlayed, "matches while rank", largestRank, "has", len(playersWGBR[largestRank]))
+	}
+}
+
+func playMatch(a *Player, b *Player, stats *SeasonStats, rng *rand.Rand, config *Config) (int, int, int) {
+	aFaction, aSkill := factionSkill(a, rng, config)
+	bFaction, bSkill := factionSkill(b, rng, config)
+	//Going first is being on the play
+	hasFirst := config.SkillDimensions || config.CoinFlipAdvantage > 0
+	aFirst := false
+	if hasFirst {
+		aFirst = rng.Float64() < 0.5
+	}
+	if config.SkillDimensions {
+		aSkill = roleSkill(&a.Skill, aSkill, aFirst, config)
+		bSkill = roleSkill(&b.Skill, bSkill, !aFirst, config)
+	}
+	stats.SkillGaps[a.Rank] = append(stats.SkillGaps[a.Rank], math.Abs(aSkill-bSkill))
+	updateMMR(a, aSkill, config)
+	updateMMR(b, bSkill, config)
+	aRankedUp := 0
+	bRankedUp := 0
+
+	aAdvantage := config.CoinFlipAdvantage
+	if !aFirst {
+		aAdvantage = -aAdvantage
+	}
+	matchOutcome := rollMatch(aSkill, bSkill, aAdvantage, rng, config)
+
+	recordMatch(a.Rank, aSkill, bSkill, hasFirst, aFirst, matchOutcome, stats)
+	recordOpponents(a, b, aFaction, bFaction, a.Rank, matchOutcome, stats, config)
+
+	//Exactly one player gets the win, unless it's a draw
+	if matchOutcome < 0 {
+		_, aRankedUp = addWin(a, config)
+		_, bRankedUp = addLoss(b, config)
+	} else if matchOutcome > 0 {
+		_, aRankedUp = addLoss(a, config)
+		_, bRankedUp = addWin(b, config)
+	} else {
+		addDraw(a, config)
+		addDraw(b, config)
+	}
+
+	return matchOutcome, aRankedUp, bRankedUp
+}
+
+func factionSkill(p *Player, rng *rand.Rand, config *Config) (int, float64) {
+	//The player's skill this match and the faction they picked for it, before any role is applied
+	skill := p.Skill.Calc(&p.Skill, p.GamesPlayed)
+	if config.FactionCount <= 1 {
+		return 0, skill
+	}
+	faction := pickFaction(p, rng, config)
+	return faction, skill * p.Factions[faction]
+}
+
+func updateMMR(p *Player, skill float64, config *Config) {
+	if config.RatingSystem == "mmr" {
+		//Moves towards the skill shown this match, win or lose, so it's independent of the pieces ladder
+		p.MMR += config.MMRWeight * (skill - p.MMR)
+	}
+}
+
+func recordMatch(rank int, aSkill float64, bSkill float64, hasFirst bool, aFirst bool, matchOutcome int, stats *SeasonStats) {
+	//Stats about the match as a whole, indexed by rank
+	if hasFirst && matchOutcome != 0 {
+		stats.FirstPlayerMatches++
+		if aFirst == (matchOutcome < 0) {
+			stats.FirstPlayerWins++
+		}
+	}
+
+	//Track how often the higher skilled player wins. Draws aren't counted.
+	if aSkill != bSkill && matchOutcome != 0 {
+		stats.FavoriteMatches[rank]++
+		if (aSkill > bSkill && matchOutcome < 0) || (bSkill > aSkill && matchOutcome > 0) {
+			stats.FavoriteWins[rank]++
+		}
+	}
+}
+
+func recordOpponents(a *Player, b *Player, aFaction int, bFaction int, rank int, matchOutcome int, stats *SeasonStats, config *Config) {
+	//Stats and ratings between two players on opposite sides, a's side won when matchOutcome < 0
+	if config.FactionCount > 1 && matchOutcome != 0 {
+		stats.FactionMatches[aFaction]++
+		stats.FactionMatches[bFaction]++
+		if matchOutcome < 0 {
+			stats.FactionWins[aFaction]++
+		} else {
+			stats.FactionWins[bFaction]++
+		}
+	}
+
+	//Track how newcomers fare against players from earlier seasons
+	aNewcomer := a.Season == a.JoinedSeason
+	bNewcomer := b.Season == b.JoinedSeason
+	if aNewcomer != bNewcomer && matchOutcome != 0 {
+		stats.NewcomerMatches[rank]++
+		if (aNewcomer && matchOutcome < 0) || (bNewcomer && matchOutcome > 0) {
+			stats.NewcomerWins[rank]++
+		}
+	}
+
+	if config.RatingSystem == "elo" {
+		playMatchElo(a, b, matchOutcome, config)
+	} else if config.RatingSystem == "glicko" {
+		updateGlicko(a, b, matchOutcome)
+	}
+}
+
+func roleSkill(skill *Skill, first float64, onPlay bool, config *Config) float64 {
+	//first is the first component after learning. The second is as far along the same curve.
+	second := 0.0
+	if skill.max > 0 {
+		second = first * skill.second / skill.max
+	}
+	if onPlay {
+		return config.PlayWeight*first + (1-config.PlayWeight)*second
+	}
+	return (1-config.PlayWeight)*first + config.PlayWeight*second
+}
+
+func pickFaction(p *Player, rng *rand.Rand, config *Config) int {
+	if config.FactionSelection == "random" {
+		return rng.Intn(len(p.Factions))
+	}
+
+	best := 0
+	for f := 1; f < len(p.Factions); f++ {
+		if p.Factions[f] > p.Factions[best] {
+			best = f
+		}
+	}
+	return best
+}
+
+func rollMatch(aSkill float64, bSkill float64, aAdvantage float64, rng *rand.Rand, config *Config) int {
+	//Same result as rollOutcome, -1 is a win for a. Drawn rounds count for nobody, and a bo3 still level after three rounds is a draw.
+	if config.MatchFormat != "bo3" {
+		return rollOutcome(aSkill, bSkill, aAdvantage, rng, config)
+	}
+
+	aRounds := 0
+	bRounds := 0
+	for round := 0; round < 3 && aRounds < 2 && bRounds < 2; round++ {
+		roundOutcome := rollOutcome(aSkill, bSkill, aAdvantage, rng, config)
+		if roundOutcome < 0 {
+			aRounds++
+		} else if roundOutcome > 0 {
+			bRounds++
+		}
+	}
+
+	if aRounds > bRounds {
+		return -1
+	} else if bRounds > aRounds {
+		return 1
+	}
+	return 0
+}
+
+func rollOutcome(aSkill float64, bSkill float64, aAdvantage float64, rng *rand.Rand, config *Config) int {
+	//-1 is a win for a, 1 a win for b and 0 a draw. aAdvantage is added to a's chance whichever way the match is decided.
+	matchOutcome := 0
+
+	if config.DrawProbability > 0 && rng.Float64() < config.DrawProbability {
+		matchOutcome = 0
+	} else if config.UpsetFactor > 0 && rng.Float64() < 2*config.UpsetFactor {
+		if rng.Float64() < 0.5+aAdvantage {
+			matchOutcome = -1
+		} else {
+			matchOutcome = 1
+		}
+	} else if rng.Float64() < modelWinProbability(aSkill, bSkill, config)+aAdvantage {
+		matchOutcome = -1
+	} else {
+		matchOutcome = 1
+	}
+
+	return matchOutcome
+}
+
+func formParties(players []Player, playersWithGames []int, playersWGBR [][]int, rng *rand.Rand, config *Config) [][]int {
+	//Group a PartyRate share of the players with games into parties, taking them out of the rank buckets
+	parties := make([][]int, 0)
+	party := make([]int, 0)
+	size := 2 + int(rng.Float64()*float64(config.PartySize-1))
+	for i := 0; i < len(playersWithGames); i++ {
+		if rng.Float64() >= config.PartyRate {
+			continue
+		}
+		party = append(party, playersWithGames[i])
+		if len(party) < size {
+			continue
+		}
+
+		for m := 0; m < len(party); m++ {
+			players[party[m]].Party = len(parties)
+			playersWGBR[players[party[m]].Rank] = removeValue(playersWGBR[players[party[m]].Rank], party[m])
+		}
+		parties = append(parties, party)
+		party = make([]int, 0)
+		size = 2 + int(rng.Float64()*float64(config.PartySize-1))
+	}
+
+	//Anyone left waiting on a full party just queues solo
+	return parties
+}
+
+func playPartyMatch(players []Player, parties [][]int, aParty int, playersWithGames []int, playersWGBR [][]int, stats *SeasonStats, rng *rand.Rand, config *Config) ([]int, bool) {
+	//Parties play a random party of the same size. Without one, a's party breaks up and its members queue solo.
+	candidates := make([]int, 0)
+	for i := 0; i < len(parties); i++ {
+		if i != aParty && len(parties[i]) == len(parties[aParty]) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		dissolveParty(players, parties, aParty, playersWGBR)
+		return playersWithGames, false
+	}
+	bParty := candidates[int(rng.Float64()*float64(len(candidates)))]
+	aMembers := parties[aParty]
+	bMembers := parties[bParty]
+	//Match stats are kept at the rank of a's first member
+	rank := players[aMembers[0]].Rank
+
+	//Each member brings their own faction and role, like a solo match, and the party plays on their average
+	aFactions := make([]int, len(aMembers))
+	aSkills := make([]float64, len(aMembers))
+	for i := 0; i < len(aMembers); i++ {
+		aFactions[i], aSkills[i] = factionSkill(&players[aMembers[i]], rng, config)
+	}
+	bFactions := make([]int, len(bMembers))
+	bSkills := make([]float64, len(bMembers))
+	for i := 0; i < len(bMembers); i++ {
+		bFactions[i], bSkills[i] = factionSkill(&players[bMembers[i]], rng, config)
+	}
+	hasFirst := config.SkillDimensions || config.CoinFlipAdvantage > 0
+	aFirst := false
+	if hasFirst {
+		aFirst = rng.Float64() < 0.5
+	}
+	aSkill := 0.0
+	for i := 0; i < len(aMembers); i++ {
+		m := &players[aMembers[i]]
+		if config.SkillDimensions {
+			aSkills[i] = roleSkill(&m.Skill, aSkills[i], aFirst, config)
+		}
+		updateMMR(m, aSkills[i], config)
+		aSkill += aSkills[i] / float64(len(aMembers))
+	}
+	bSkill := 0.0
+	for i := 0; i < len(bMembers); i++ {
+		m := &players[bMembers[i]]
+		if config.SkillDimensions {
+			bSkills[i] = roleSkill(&m.Skill, bSkills[i], !aFirst, config)
+		}
+		updateMMR(m, bSkills[i], config)
+		bSkill += bSkills[i] / float64(len(bMembers))
+	}
+	stats.SkillGaps[rank] = append(stats.SkillGaps[rank], math.Abs(aSkill-bSkill))
+
+	aAdvantage := config.CoinFlipAdvantage
+	if !aFirst {
+		aAdvantage = -aAdvantage
+	}
+	//Everyone in a party shares the outcome, but ranks move per member
+	matchOutcome := rollMatch(aSkill, bSkill, aAdvantage, rng, config)
+	recordMatch(rank, aSkill, bSkill, hasFirst, aFirst, matchOutcome, stats)
+	//Parties are the same size, so each member is rated against the opposing member in the same slot
+	for i := 0; i < len(aMembers); i++ {
+		recordOpponents(&players[aMembers[i]], &players[bMembers[i]], aFactions[i], bFactions[i], rank, matchOutcome, stats, config)
+	}
+	for i := 0; i < len(parties[aParty]); i++ {
+		m := &players[parties[aParty][i]]
+		if matchOutcome < 0 {
+			addWin(m, config)
+		} else if matchOutcome > 0 {
+			addLoss(m, config)
+		} else {
+			addDraw(m, config)
+		}
+	}
+	for i := 0; i < len(parties[bParty]); i++ {
+		m := &players[parties[bParty][i]]
+		if matchOutcome > 0 {
+			addWin(m, config)
+		} else if matchOutcome < 0 {
+			addLoss(m, config)
+		} else {
+			addDraw(m, config)
+		}
+	}
+
+	//A party breaks up as soon as any member is done for the season
+	matchParties := []int{aParty, bParty}
+	for p := 0; p < len(matchParties); p++ {
+		party := matchParties[p]
+		done := false
+		for i := 0; i < len(parties[party]); i++ {
+			m := &players[parties[party][i]]
+			//ProRank players don't need to progress in this model, just end their season. Skipped games don't count towards GamesPlayed.
+			if m.Rank == 0 {
+				m.GamesLeft = 0
+			}
+			if m.GamesLeft <= 0 {
+				playersWithGames = removeValue(playersWithGames, parties[party][i])
+				done = true
+			}
+		}
+		if done {
+			dissolveParty(players, parties, party, playersWGBR)
+		}
+	}
+
+	return playersWithGames, true
+}
+
+func dissolveParty(players []Player, parties [][]int, party int, playersWGBR [][]int) {
+	//Members with games left go back to queueing solo at their current rank
+	for i := 0; i < len(parties[party]); i++ {
+		m := parties[party][i]
+		players[m].Party = -1
+		if players[m].GamesLeft > 0 {
+			playersWGBR[players[m].Rank] = append(playersWGBR[players[m].Rank], m)
+		}
+	}
+	parties[party] = nil
+}
+
+func removeValue(list []int, value int) []int {
+	//Swap remove, order isn't kept
+	for i := 0; i < len(list); i++ {
+		if list[i] == value {
+			list[i] = list[len(list)-1]
+			return list[:len(list)-1]
+		}
+	}
+	return list
+}
+
+func playMatchElo(a *Player, b *Player, matchOutcome int, config *Config) {
+	//matchOutcome as in playMatch, -1 is a win for a. A tie is scored as a draw.
+	aScore := 0.5
+	if matchOutcome < 0 {
+		aScore = 1.0
+	} else if matchOutcome > 0 {
+		aScore = 0.0
+	}
+
+	aExpected := 1.0 / (1.0 + math.Pow(10, (b.EloRating-a.EloRating)/400))
+	a.EloRating += config.EloK * (aScore - aExpected)
+	b.EloRating += config.EloK * ((1.0 - aScore) - (1.0 - aExpected))
+}
+
+func updateGlicko(a *Player, b *Player, outcome int) {
+	//outcome as in playMatch, -1 is a win for a. A tie is scored as a draw.
+	aScore := 0.5
+	if outcome < 0 {
+		aScore = 1.0
+	} else if outcome > 0 {
+		aScore = 0.0
+	}
+
+	//Ratings only move at the end of the rating period, so both sides see each other's ratings from the start of the season
+	addGlickoResult(&a.Glicko, &b.Glicko, aScore)
+	addGlickoResult(&b.Glicko, &a.Glicko, 1.0-aScore)
+}
+
+func addGlickoResult(player *Glicko, opponent *Glicko, score float64) {
+	//173.7178 converts from the Glicko scale to the Glicko-2 scale
+	mu := (player.rating - 1500) / 173.7178
+	opponentMu := (opponent.rating - 1500) / 173.7178
+	opponentPhi := opponent.deviation / 173.7178
+
+	g := 1.0 / math.Sqrt(1.0+3.0*opponentPhi*opponentPhi/(math.Pi*math.Pi))
+	expected := 1.0 / (1.0 + math.Exp(-g*(mu-opponentMu)))
+
+	player.vInverse += g * g * expected * (1.0 - expected)
+	player.improvement += g * (score - expected)
+}
+
+func applyGlicko(player *Glicko, config *Config) {
+	//The Glicko-2 update from Glickman's paper, steps 3 through 8. Ratings are on the Glicko scale outside this function.
+	mu := (player.rating - 1500) / 173.7178
+	phi := player.deviation / 173.7178
+	sigma := player.volatility
+
+	//Players that sat out only grow less certain
+	if player.vInverse == 0 {
+		player.deviation = math.Sqrt(phi*phi+sigma*sigma) * 173.7178
+		return
+	}
+
+	v := 1.0 / player.vInverse
+	delta := v * player.improvement
+
+	//Find the new volatility with the Illinois algorithm
+	tau := config.GlickoTau
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	B := 0.0
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA := f(A)
+	fB := f(B)
+	for math.Abs(B-A) > 0.000001 {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A = B
+			fA = fB
+		} else {
+			fA /= 2
+		}
+		B = C
+		fB = fC
+	}
+	sigma = math.Exp(A / 2)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1.0 / math.Sqrt(1.0/(phiStar*phiStar)+1.0/v)
+	mu += phi * phi * player.improvement
+
+	player.rating = mu*173.7178 + 1500
+	player.deviation = phi * 173.7178
+	player.volatility = sigma
+	player.vInverse = 0
+	player.improvement = 0
+}
+
+func winProbability(aSkill float64, bSkill float64, config *Config) float64 {
+	p := modelWinProbability(aSkill, bSkill, config)
+
+	//Upsets are coin flips, see playMatch
+	p = (1.0-2*config.UpsetFactor)*p + config.UpsetFactor
+	if config.MatchFormat == "bo3" {
+		//Wins two rounds straight, or splits the first two and takes the third. Ignores drawn rounds.
+		p = p * p * (3 - 2*p)
+	}
+	return p
+}
+
+func modelWinProbability(aSkill float64, bSkill float64, config *Config) float64 {
+	//a's chance to win a single game under WinModel, before draws, upsets and any advantage. WinCurveSteepness widens or narrows the gap each model sees.
+	if config.WinModel == "bradleyterry" {
+		return bradleyTerry(stretchGap(aSkill, bSkill, config.WinCurveSteepness))
+	} else if config.WinModel == "logistic" {
+		return logisticWinProbability(aSkill, bSkill, config)
+	}
+	aSkill, bSkill = stretchGap(aSkill, bSkill, config.WinCurveSteepness)
+	return matchProbability(aSkill, bSkill, config.SkillWinWeight, config.SkillMin, config.SkillMax)
+}
+
+func stretchGap(aSkill float64, bSkill float64, steepness float64) (float64, float64) {
+	//Moves both skills away from their mean by steepness times their distance to it, so at 2 a 0.6 plays a 0.4 like a 0.7 plays a 0.3. Neither drops below 0.
+	if steepness == 1.0 {
+		return aSkill, bSkill
+	}
+	mean := (aSkill + bSkill) / 2
+	half := steepness * (aSkill - bSkill) / 2
+	return math.Max(0.0, mean+half), math.Max(0.0, mean-half)
+}
+
+func matchProbability(aSkill float64, bSkill float64, winWeight float64, skillMin float64, skillMax float64) float64 {
+	//The linear model's chance for a to win, the odds of winWeight*0.5 + (1-winWeight)*rand*(a+b) landing under a's skill. Skills are first placed in the band, so a narrow band such as [0.9, 1] plays like the default [0, 1]. Pure, so it can be checked against sampled outcomes.
+	aSkill = math.Max(0.0, (aSkill-skillMin)/(skillMax-skillMin))
+	bSkill = math.Max(0.0, (bSkill-skillMin)/(skillMax-skillMin))
+	if aSkill+bSkill == 0 {
+		return 0.5
+	}
+	if winWeight >= 1.0 {
+		if aSkill > 0.5 {
+			return 1.0
+		} else if aSkill < 0.5 {
+			return 0.0
+		}
+		return 0.5
+	}
+	return math.Max(0.0, math.Min(1.0, (aSkill-winWeight*0.5)/((1.0-winWeight)*(aSkill+bSkill))))
+}
+
+func logisticWinProbability(aSkill float64, bSkill float64, config *Config) float64 {
+	//k is 2 at a SkillWinWeight of zero, matching the slope of a/(a+b) between two 0.5 skill players, and goes to infinity at 1 where the higher skilled player always wins. WinCurveSteepness scales it.
+	if config.SkillWinWeight >= 1.0 {
+		if aSkill > bSkill {
+			return 1.0
+		} else if aSkill < bSkill {
+			return 0.0
+		}
+		return 0.5
+	}
+	k := config.WinCurveSteepness * 2.0 / (1.0 - config.SkillWinWeight)
+	return 1.0 / (1.0 + math.Exp(-k*(aSkill-bSkill)))
+}
+
+func bradleyTerry(aSkill float64, bSkill float64) float64 {
+	//Two zero skill players are evenly matched
+	if aSkill+bSkill == 0 {
+		return 0.5
+	}
+	return aSkill / (aSkill + bSkill)
+}
+
+func addWin(player *Player, config *Config) (bool, int) {
+	ranks := rankSystem(config)
+	rank := ranks.RankOf(player)
+	//Modify GamesPlayed
+	player.GamesLeft--
+	player.GamesPlayed++
+	player.Wins++
+	player.FailedMatchMaking = 0
+	//Modify Streak
+	if player.Streak < 0 {
+		player.Streak = 1
+	} else {
+		player.Streak++
+	}
+	//Modify Pieces / Rank
+	ranks.OnWin(player)
+	rankedUp := rank - ranks.RankOf(player)
+	if rankedUp != 0 && config.StreakScope == "perRank" {
+		player.Streak = 0
+	}
+	if rankedUp > 0 && player.RankProgression[len(player.RankProgression)-1].Rank > ranks.RankOf(player) {
+		progression := RankProgression{Rank: ranks.RankOf(player), GamesPlayed: player.GamesPlayed, Season: player.Season}
+		if config.RankProgressionMode == "summary" {
+			player.RankProgression[len(player.RankProgression)-1] = progression
+		} else {
+			player.RankProgression = append(player.RankProgression, progression)
+		}
+	}
+	endCalibration(player, config)
+
+	if player.GamesLeft == 0 {
+		return false, rankedUp
+	}
+
+	return true, rankedUp
+}
+
+func addDraw(player *Player, config *Config) bool {
+	//Draws use up a game but leave Streak and Pieces as they were
+	player.GamesLeft--
+	player.GamesPlayed++
+	player.Draws++
+	player.FailedMatchMaking = 0
+	endCalibration(player, config)
+
+	return player.GamesLeft != 0
+}
+
+func addLoss(player *Player, config *Config) (bool, int) {
+	ranks := rankSystem(config)
+	rank := ranks.RankOf(player)
+	//Modify GamesPlayed
+	player.GamesLeft--
+	player.GamesPlayed++
+	player.Losses++
+	player.FailedMatchMaking = 0
+	//Modify Streak
+	if player.Streak > 0 {
+		player.Streak = -1
+	} else {
+		player.Streak--
+	}
+	//Modify Pieces / Rank
+	ranks.OnLoss(player)
+	rankedDown := rank - ranks.RankOf(player)
+	if rankedDown != 0 && config.StreakScope == "perRank" {
+		player.Streak = 0
+	}
+	endCalibration(player, config)
+
+	if player.GamesLeft == 0 {
+		return false, rankedDown
+	}
+
+	return true, rankedDown
+}
+
+func rankSystem(config *Config) RankSystem {
+	if config.LadderType == "simple" {
+		return SimpleRankSystem{config}
+	}
+	return PieceRankSystem{config}
+}
+
+func (ranks PieceRankSystem) OnWin(player *Player) {
+	config := ranks.config
+	pieces := 1
+	if !config.NoStreakBonus && player.Streak >= config.StreakThreshold && player.Rank > config.StreakBonusRank {
+		pieces = config.StreakBonusPieces
+	}
+	if player.Calibrating {
+		pieces *= 3
+	}
+	player.Pieces += pieces
+	player.PiecesEarned += pieces
+	//This is a little strange. You need more than the rank's pieces to rank up, but when you do you rank with 1 piece already.
+	if player.Rank != 0 && player.Pieces > piecesToLeave(player.Rank, config) {
+		player.Pieces -= piecesToLeave(player.Rank, config)
+		player.Rank--
+		if player.Rank < len(config.RankUpStartingPieces) {
+			player.Pieces = config.RankUpStartingPieces[player.Rank]
+		}
+	}
+}
+
+func (ranks PieceRankSystem) OnLoss(player *Player) {
+	config := ranks.config
+	if player.Rank > config.FreeLossRank {
+		player.Streak = 0
+	} else if (player.Rank > config.LossStreakRank && player.Streak < -1) || (player.Rank <= config.LossStreakRank) {
+		player.Streak = 0
+		if player.Pieces > 0 {
+			pieces := 1
+			if player.Calibrating {
+				pieces = int(math.Min(3, float64(player.Pieces)))
+			}
+			player.Pieces -= pieces
+			player.PiecesLost += pieces
+		} else {
+			//Streak is already reset here, so deranking is the same under either StreakScope
+			//Can't derank due to loss in ProRank, just lose MMR. MaxRank is the bottom of the ladder.
+			if config.Derank && player.Rank != 0 && player.Rank < config.MaxRank {
+				player.Rank++
+				player.Pieces += piecesToLeave(player.Rank, config)
+			}
+		}
+	}
+}
+
+func piecesToLeave(rank int, config *Config) int {
+	if rank < len(config.RankPieces) {
+		return config.RankPieces[rank]
+	}
+	return config.PiecesPerRank
+}
+
+func (ranks PieceRankSystem) RankOf(player *Player) int {
+	return player.Rank
+}
+
+func (ranks SimpleRankSystem) OnWin(player *Player) {
+	if player.Rank != 0 {
+		player.Rank--
+	}
+}
+
+func (ranks SimpleRankSystem) OnLoss(player *Player) {
+	//Pro Rank is kept once reached, as with pieces
+	if player.Rank != 0 && player.Rank < ranks.config.MaxRank {
+		player.Rank++
+	}
+}
+
+func (ranks SimpleRankSystem) RankOf(player *Player) int {
+	return player.Rank
+}
+
+func endCalibration(player *Player, config *Config) {
+	//Placement is wherever the player stands once their calibration games are up
+	if !player.Calibrating || player.GamesPlayed < config.CalibrationGames {
+		return
+	}
+	player.Calibrating = false
+	player.PlacementRank = player.Rank
+	player.PlacementSeason = player.Season
+}
+
+func makeOutputDir(config *Config) error {
+	if config.OutputDir == "" {
+		return nil
+	}
+	return os.MkdirAll(config.OutputDir, 0755)
+}
+
+func checkError(message string, err error) {
+	if err != nil {
+		log.Fatal(message, err)
+	}
+}
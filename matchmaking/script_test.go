@@ -0,0 +1,1537 @@
+package matchmaking
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	//The simulation logs every season, keep test output to the failures
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestMaxRank15(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.MaxRank = 15
+	config.FreeLossRank = 15
+	config.LossStreakRank = 7
+	config.Derank = true
+	config.Seasons = 4
+	config.PlayersPerSeason = 200
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sim := NewSimulation(config)
+	sim.Run()
+	players := sim.Players
+	for i := 0; i < len(players); i++ {
+		if players[i].Rank < 0 || players[i].Rank > config.MaxRank {
+			t.Fatalf("player %d ended at rank %d, outside 0 to %d", i, players[i].Rank, config.MaxRank)
+		}
+	}
+}
+
+func TestDerankStopsAtMaxRank(t *testing.T) {
+	config := DefaultConfig()
+	config.FreeLossRank = config.MaxRank
+	config.Derank = true
+	player := Player{Rank: config.MaxRank, Streak: -5}
+
+	PieceRankSystem{&config}.OnLoss(&player)
+	if player.Rank != config.MaxRank {
+		t.Errorf("a loss at MaxRank %d moved the player to rank %d", config.MaxRank, player.Rank)
+	}
+}
+
+func TestValidateLossRanksAboveMaxRank(t *testing.T) {
+	config := DefaultConfig()
+	config.FreeLossRank = config.MaxRank + 1
+	if config.Validate() == nil {
+		t.Error("FreeLossRank above MaxRank passed Validate")
+	}
+
+	config = DefaultConfig()
+	config.MaxRank = 15
+	config.FreeLossRank = 15
+	config.LossStreakRank = 16
+	if config.Validate() == nil {
+		t.Error("LossStreakRank above MaxRank passed Validate")
+	}
+}
+
+func TestAddWin(t *testing.T) {
+	tests := []struct {
+		name       string
+		rank       int
+		pieces     int
+		streak     int
+		wantRank   int
+		wantPieces int
+	}{
+		{"below the rank up", 10, 4, 0, 10, 5},
+		//More than PiecesPerRank is needed, so the sixth piece ranks up and carries one over
+		{"rank up at 6 pieces", 10, 5, 0, 9, 1},
+		{"streak bonus above rank 7", 8, 0, 2, 8, 2},
+		{"no streak bonus at rank 7", 7, 0, 2, 7, 1},
+		{"streak below the threshold", 8, 0, 1, 8, 1},
+		{"a loss breaks the streak", 8, 0, -3, 8, 1},
+		{"streak bonus ranks up", 8, 4, 2, 7, 1},
+		{"pro rank keeps its pieces", 0, 5, 0, 0, 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			player := Player{Rank: test.rank, Pieces: test.pieces, Streak: test.streak, GamesLeft: 2}
+			player.RankProgression = []RankProgression{{Rank: test.rank}}
+
+			more, rankedUp := addWin(&player, &config)
+			if player.Rank != test.wantRank || player.Pieces != test.wantPieces {
+				t.Errorf("got rank %d with %d pieces, want rank %d with %d pieces", player.Rank, player.Pieces, test.wantRank, test.wantPieces)
+			}
+			if rankedUp != test.rank-test.wantRank {
+				t.Errorf("reported %d ranks gained, want %d", rankedUp, test.rank-test.wantRank)
+			}
+			if !more || player.GamesLeft != 1 || player.Wins != 1 {
+				t.Errorf("got %d games left and %d wins after one win from 2 games", player.GamesLeft, player.Wins)
+			}
+			if player.Streak < 1 {
+				t.Errorf("streak is %d after a win", player.Streak)
+			}
+		})
+	}
+}
+
+func TestAddLoss(t *testing.T) {
+	tests := []struct {
+		name       string
+		rank       int
+		pieces     int
+		streak     int
+		derank     bool
+		wantRank   int
+		wantPieces int
+	}{
+		{"free loss above rank 25", 26, 3, -4, false, 26, 3},
+		{"rank 25 is protected like 14 to 25", 25, 3, 0, false, 25, 3},
+		{"first loss above rank 14 is free", 20, 3, 2, false, 20, 3},
+		{"second loss above rank 14 costs a piece", 20, 3, -1, false, 20, 2},
+		{"every loss at rank 14 costs a piece", 14, 3, 2, false, 14, 2},
+		{"no pieces and no derank", 10, 0, -1, false, 10, 0},
+		{"derank from no pieces", 10, 0, -1, true, 11, PiecesPerRank},
+		{"a piece left stops the derank", 10, 1, -1, true, 10, 0},
+		{"pro rank can't derank", 0, 0, -1, true, 0, 0},
+		{"protection still applies with derank", 20, 0, 0, true, 20, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Derank = test.derank
+			player := Player{Rank: test.rank, Pieces: test.pieces, Streak: test.streak, GamesLeft: 1}
+			player.RankProgression = []RankProgression{{Rank: test.rank}}
+
+			more, rankedDown := addLoss(&player, &config)
+			if player.Rank != test.wantRank || player.Pieces != test.wantPieces {
+				t.Errorf("got rank %d with %d pieces, want rank %d with %d pieces", player.Rank, player.Pieces, test.wantRank, test.wantPieces)
+			}
+			if rankedDown != test.rank-test.wantRank {
+				t.Errorf("reported %d ranks gained, want %d", rankedDown, test.rank-test.wantRank)
+			}
+			if more || player.Losses != 1 {
+				t.Errorf("got more games and %d losses after the last game was lost", player.Losses)
+			}
+		})
+	}
+}
+
+func TestFixedGamesPerSeason(t *testing.T) {
+	config := DefaultConfig()
+	config.FixedGamesPerSeason = 20
+	rng := rand.New(rand.NewSource(1))
+
+	//Players drawn with very different playtimes still get the same allotment every season
+	nextId := 0
+	players := initPlayers(200, config.GamesPerSeason, &nextId, 0, rng, &config)
+	for season := 0; season < 3; season++ {
+		for i := 0; i < len(players); i++ {
+			if season > 0 {
+				setPlayerForSeason(&players[i], true, rng, &config)
+			}
+			if players[i].GamesLeft != config.FixedGamesPerSeason {
+				t.Errorf("season %d: player %d got %d games, want %d", season, i, players[i].GamesLeft, config.FixedGamesPerSeason)
+			}
+		}
+	}
+}
+
+func testPlayers(ranks []int) ([]Player, [][]int) {
+	//Flat skilled players at the given ranks, with the rank buckets matchmaking reads
+	config := DefaultConfig()
+	players := make([]Player, len(ranks))
+	buckets := make([][]int, config.MaxRank+1)
+	for i := 0; i < len(ranks); i++ {
+		players[i] = Player{Id: i, Rank: ranks[i], GamesLeft: 1, Party: -1, Skill: Skill{max: 0.5, mode: "flat", Calc: CalcSkill}}
+		players[i].RankProgression = []RankProgression{{Rank: ranks[i]}}
+		buckets[ranks[i]] = append(buckets[ranks[i]], i)
+	}
+	return players, buckets
+}
+
+func TestPartyMatchRatesAndRecords(t *testing.T) {
+	systems := []string{"elo", "mmr"}
+	for r := 0; r < len(systems); r++ {
+		config := DefaultConfig()
+		config.RatingSystem = systems[r]
+		stats := NewSeasonStats(&config)
+		rng := rand.New(rand.NewSource(1))
+		//A strong veteran party against a weak newcomer party, all at rank 10
+		players, buckets := testPlayers([]int{10, 10, 10, 10})
+		parties := [][]int{{0, 1}, {2, 3}}
+		for i := 0; i < len(players); i++ {
+			players[i].Party = i / 2
+			players[i].GamesLeft = 10
+			players[i].EloRating = EloStart
+			players[i].MMR = 0.5
+		}
+		players[0].Skill.max, players[1].Skill.max = 0.9, 0.9
+		players[2].Skill.max, players[3].Skill.max = 0.2, 0.2
+		players[0].Season, players[1].Season = 1, 1
+
+		_, matched := playPartyMatch(players, parties, 0, []int{0, 1, 2, 3}, buckets, stats, rng, &config)
+		if !matched {
+			t.Fatalf("%s: parties of the same size didn't match", systems[r])
+		}
+		if len(stats.SkillGaps[10]) != 1 || math.Abs(stats.SkillGaps[10][0]-0.7) > 1e-9 {
+			t.Errorf("%s: skill gaps %v, want one gap of 0.7", systems[r], stats.SkillGaps[10])
+		}
+		//Favorites are per match, newcomers are per pair of opposing members
+		if stats.FavoriteMatches[10] != 1 || stats.NewcomerMatches[10] != 2 {
+			t.Errorf("%s: %d favorite and %d newcomer matches recorded, want 1 and 2", systems[r], stats.FavoriteMatches[10], stats.NewcomerMatches[10])
+		}
+		for i := 0; i < len(players); i++ {
+			if systems[r] == "elo" && players[i].EloRating == EloStart {
+				t.Errorf("player %d kept Elo %v after a party match", i, players[i].EloRating)
+			}
+			if systems[r] == "mmr" && players[i].MMR == 0.5 {
+				t.Errorf("player %d kept MMR %v after a party match", i, players[i].MMR)
+			}
+		}
+	}
+}
+
+func TestFindOpponentAcrossEmptyRanks(t *testing.T) {
+	config := DefaultConfig()
+	rng := rand.New(rand.NewSource(1))
+
+	//Two empty ranks either side of the player at rank 10
+	players, buckets := testPlayers([]int{10, 13, 13})
+	for i := 0; i < 20; i++ {
+		bRank, bRankedIndex, matched := findOpponent(players, buckets, 10, 0, rng, &config)
+		if !matched || bRank != 13 || bRankedIndex < 0 || bRankedIndex > 1 {
+			t.Fatalf("got rank %d index %d matched %v, want one of the rank 13 players", bRank, bRankedIndex, matched)
+		}
+	}
+
+	//Equally far both ways, either side will do but nothing further out
+	players, buckets = testPlayers([]int{10, 7, 13, 20})
+	for i := 0; i < 20; i++ {
+		bRank, _, matched := findOpponent(players, buckets, 10, 0, rng, &config)
+		if !matched || (bRank != 7 && bRank != 13) {
+			t.Fatalf("got rank %d matched %v, want rank 7 or 13", bRank, matched)
+		}
+	}
+
+	//Nobody else on the ladder
+	players, buckets = testPlayers([]int{10})
+	if _, _, matched := findOpponent(players, buckets, 10, 0, rng, &config); matched {
+		t.Error("matched a player who is alone on the ladder")
+	}
+}
+
+func inTempDir(t *testing.T) {
+	//Output files are written to the working directory
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+}
+
+func writeTestFile(t *testing.T, name string, text string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios(writeTestFile(t, "good.json", `[{"Name": "base"}, {"Name": "derank", "Derank": true, "Seasons": 4}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 2 || scenarios[0].Name != "base" || scenarios[1].Name != "derank" {
+		t.Fatalf("got %v", scenarios)
+	}
+	defaults := DefaultConfig()
+	if scenarios[0].Seasons != defaults.Seasons || !scenarios[1].Derank || scenarios[1].Seasons != 4 || scenarios[1].PlayersPerSeason != defaults.PlayersPerSeason {
+		t.Errorf("scenario fields didn't layer over the defaults: %+v", scenarios)
+	}
+
+	bad := []string{
+		`[{"Seasons": 2}]`,
+		`[{"Name": "../up"}]`,
+		`[{"Name": "a"}, {"Name": "a"}]`,
+		`[{"Name": "a", "Seasonz": 2}]`,
+		`[{"Name": "a", "Seasons": "two"}]`,
+		`[{"Name": "a", "LearnScale": 0}]`,
+		`[{"Name": "a", "Runs": 3}]`,
+		`{"Name": "a"}`,
+	}
+	for i := 0; i < len(bad); i++ {
+		if _, err := LoadScenarios(writeTestFile(t, "bad.json", bad[i])); err == nil {
+			t.Errorf("%s loaded without an error", bad[i])
+		}
+	}
+}
+
+func TestStreakScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		scope      string
+		win        bool
+		rank       int
+		pieces     int
+		streak     int
+		wantStreak int
+	}{
+		{"global win keeps the streak through a rank up", "global", true, 10, 5, 1, 2},
+		{"perRank win resets the streak on a rank up", "perRank", true, 10, 5, 1, 0},
+		{"perRank win keeps the streak within a rank", "perRank", true, 10, 1, 1, 2},
+		//A loss that costs a piece or a rank always ends the streak
+		{"global derank resets the streak", "global", false, 10, 0, -1, 0},
+		{"perRank derank resets the streak", "perRank", false, 10, 0, -1, 0},
+		{"perRank free loss keeps the streak within a rank", "perRank", false, 20, 0, 2, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.StreakScope = test.scope
+			config.Derank = true
+			player := Player{Rank: test.rank, Pieces: test.pieces, Streak: test.streak, GamesLeft: 2}
+			player.RankProgression = []RankProgression{{Rank: test.rank}}
+
+			if test.win {
+				addWin(&player, &config)
+			} else {
+				addLoss(&player, &config)
+			}
+			if player.Streak != test.wantStreak {
+				t.Errorf("streak is %d at rank %d, want %d", player.Streak, player.Rank, test.wantStreak)
+			}
+		})
+	}
+}
+
+func TestBradleyTerry(t *testing.T) {
+	skills := []float64{0, 0.1, 0.5, 0.9, 1}
+	for i := 0; i < len(skills); i++ {
+		if p := bradleyTerry(skills[i], skills[i]); p != 0.5 {
+			t.Errorf("two %v skill players: got %v, want exactly 0.5", skills[i], p)
+		}
+	}
+	if p := bradleyTerry(0.75, 0.25); p != 0.75 {
+		t.Errorf("0.75 against 0.25: got %v, want 0.75", p)
+	}
+}
+
+func TestInverseLearnFloor(t *testing.T) {
+	config := DefaultConfig()
+	config.Learn = true
+	config.InverseLearning = true
+	config.InverseLearnFloor = 0.2
+	rng := rand.New(rand.NewSource(1))
+	curves := []string{"arctan", "logistic", "power"}
+
+	for c := 0; c < len(curves); c++ {
+		config.CurveType = curves[c]
+		for i := 0; i < 100; i++ {
+			player := NewPlayer(i, 0, 0, 0, 0, rng, &config)
+			//The floor can't lift a player above their own max
+			floor := math.Min(config.InverseLearnFloor, player.Skill.max)
+			for games := 0; games <= 1000000; games = games*2 + 1 {
+				if skill := player.Skill.Calc(&player.Skill, games); skill < floor {
+					t.Fatalf("%s curve: player with max %v fell to %v after %d games, floor %v", curves[c], player.Skill.max, skill, games, floor)
+				}
+			}
+		}
+	}
+}
+
+func meanRank(players []Player) float64 {
+	total := 0
+	for i := 0; i < len(players); i++ {
+		total += players[i].Rank
+	}
+	return float64(total) / float64(len(players))
+}
+
+func TestSampleRateTracksFullRun(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 2
+	config.PlayersPerSeason = 2000
+	fullSim := NewSimulation(config)
+	fullSim.Run()
+	full, fullSummaries := fullSim.Players, fullSim.Summaries
+
+	config.SampleRate = 0.5
+	sampledSim := NewSimulation(config)
+	sampledSim.Run()
+	sampled, sampledSummaries := sampledSim.Players, sampledSim.Summaries
+
+	fullGames := 0
+	sampledGames := 0
+	for i := 0; i < len(full); i++ {
+		fullGames += full[i].GamesPlayed
+		sampledGames += sampled[i].GamesPlayed
+	}
+	//Deferred games are still played, just not matched, so the totals stay close
+	if math.Abs(float64(sampledGames-fullGames)) > 0.05*float64(fullGames) {
+		t.Errorf("sampled run played %d games, full run %d", sampledGames, fullGames)
+	}
+	ratio := float64(sampledSummaries[1].Matches) / float64(fullSummaries[1].Matches)
+	if ratio < 0.4 || ratio > 0.6 {
+		t.Errorf("sampled run matched %v of the full run's matches, want about half", ratio)
+	}
+	//Deferred games don't move opponents, so the sampled ladder sits a couple of ranks lower. This is the drift SampleRate trades for speed.
+	if gap := meanRank(sampled) - meanRank(full); math.Abs(gap) > 3 {
+		t.Errorf("sampled mean rank is %v ranks from the full run's", gap)
+	}
+}
+
+func TestOneCSVRowPerRank(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seasons = 1
+	populations := []int{3, 300}
+
+	for n := 0; n < len(populations); n++ {
+		config.PlayersPerSeason = populations[n]
+		sim := NewSimulation(config)
+		writeSeasonResult(sim.Run()[0], &sim.Config)
+
+		file, err := os.Open("NoDerankNoLearn.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows)-1 != 31 {
+			t.Errorf("%d players: got %d data rows, want 31", populations[n], len(rows)-1)
+			continue
+		}
+		for r := 1; r < len(rows); r++ {
+			if rows[r][0] != strconv.Itoa(r-1) {
+				t.Errorf("%d players: row %d is rank %s", populations[n], r, rows[r][0])
+			}
+		}
+	}
+}
+
+func TestUpsetFactorRaisesUnderdogWins(t *testing.T) {
+	config := DefaultConfig()
+	rng := rand.New(rand.NewSource(1))
+	factors := []float64{0, 0.1, 0.2, 0.3}
+	lastChance := -1.0
+	lastRate := -1.0
+
+	for f := 0; f < len(factors); f++ {
+		config.UpsetFactor = factors[f]
+		//a is the underdog
+		chance := winProbability(0.3, 0.7, &config)
+		stats := NewSeasonStats(&config)
+		for i := 0; i < 20000; i++ {
+			a := Player{Rank: 20, GamesLeft: 1, Skill: Skill{max: 0.3, mode: "flat", Calc: CalcSkill}}
+			b := Player{Rank: 20, GamesLeft: 1, Skill: Skill{max: 0.7, mode: "flat", Calc: CalcSkill}}
+			a.RankProgression = []RankProgression{{Rank: 20}}
+			b.RankProgression = []RankProgression{{Rank: 20}}
+			playMatch(&a, &b, stats, rng, &config)
+		}
+		rate := 1 - float64(stats.FavoriteWins[20])/float64(stats.FavoriteMatches[20])
+
+		if chance <= lastChance || rate <= lastRate {
+			t.Errorf("UpsetFactor %v: underdog chance %v and win rate %v, not above %v and %v at the lower factor", factors[f], chance, rate, lastChance, lastRate)
+		}
+		if math.Abs(rate-chance) > 0.02 {
+			t.Errorf("UpsetFactor %v: underdog won %v of matches, winProbability says %v", factors[f], rate, chance)
+		}
+		lastChance = chance
+		lastRate = rate
+	}
+}
+
+func TestRankUpStartingPieces(t *testing.T) {
+	//The default carries one piece over at every rank
+	config := DefaultConfig()
+	player := Player{Rank: 3, Pieces: 5, GamesLeft: 1}
+	player.RankProgression = []RankProgression{{Rank: 3}}
+	addWin(&player, &config)
+	if player.Rank != 2 || player.Pieces != 1 {
+		t.Errorf("default rank up got rank %d with %d pieces, want rank 2 with 1", player.Rank, player.Pieces)
+	}
+
+	config.RankUpStartingPieces = []int{0, 4, 3, 3, 2, 2, 0}
+	for rank := 1; rank <= 30; rank++ {
+		player := Player{Rank: rank, Pieces: 5, GamesLeft: 1}
+		player.RankProgression = []RankProgression{{Rank: rank}}
+		addWin(&player, &config)
+
+		//Past the table the extra piece carries over
+		want := 1
+		if rank-1 < len(config.RankUpStartingPieces) {
+			want = config.RankUpStartingPieces[rank-1]
+		}
+		if player.Rank != rank-1 || player.Pieces != want {
+			t.Errorf("ranking up from %d: got rank %d with %d pieces, want rank %d with %d", rank, player.Rank, player.Pieces, rank-1, want)
+		}
+	}
+}
+
+func TestSeasonAllocsPerMatch(t *testing.T) {
+	//Setting up players and recording rank ups allocates, the matchmaking loop itself shouldn't. About 0.12 per match today, anything allocating every match is at least 1.
+	const ceiling = 0.2
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 1
+	config.PlayersPerSeason = 1000
+	matches := 0
+	allocs := testing.AllocsPerRun(3, func() {
+		sim := NewSimulation(config)
+		sim.runSeason(0, nil)
+		matches = sim.Summaries[0].Matches
+	})
+
+	if matches == 0 {
+		t.Fatal("no matches were played")
+	}
+	if perMatch := allocs / float64(matches); perMatch > ceiling {
+		t.Errorf("season allocated %v times over %d matches, %v per match, ceiling %v", allocs, matches, perMatch, ceiling)
+	}
+}
+
+func TestWinCurveSteepnessSharpens(t *testing.T) {
+	models := []string{"linear", "bradleyterry", "logistic"}
+	steepness := []float64{0.5, 1, 2, 4}
+	gaps := []float64{0.05, 0.1, 0.2, 0.3}
+
+	for m := 0; m < len(models); m++ {
+		config := DefaultConfig()
+		config.WinModel = models[m]
+		for g := 0; g < len(gaps); g++ {
+			last := 0.5
+			for s := 0; s < len(steepness); s++ {
+				config.WinCurveSteepness = steepness[s]
+				//The favorite's edge grows with steepness at every gap
+				p := winProbability(0.5+gaps[g]/2, 0.5-gaps[g]/2, &config)
+				if p <= last {
+					t.Errorf("%s, gap %v at steepness %v: favorite wins %v, not above %v", models[m], gaps[g], steepness[s], p, last)
+				}
+				last = p
+			}
+		}
+
+		//Steepness scales the gap, so at 2 a 0.25 plays a 0.15 like a 0.3 plays a 0.1
+		config.WinCurveSteepness = 2
+		steep := winProbability(0.25, 0.15, &config)
+		config.WinCurveSteepness = 1
+		if p := winProbability(0.3, 0.1, &config); math.Abs(steep-p) > 1e-12 {
+			t.Errorf("%s: steepness 2 played 0.25 against 0.15 at %v, want %v like 0.3 against 0.1", models[m], steep, p)
+		}
+
+		//Equal skills stay a coin flip however steep the curve
+		config.WinCurveSteepness = 4
+		if p := winProbability(0.5, 0.5, &config); p != 0.5 {
+			t.Errorf("%s: equal skills at steepness 4: got %v, want 0.5", models[m], p)
+		}
+	}
+}
+
+func TestSeasonWithNoActivePlayers(t *testing.T) {
+	inTempDir(t)
+	//Nobody is given any games, so every season has players but none of them active
+	config := DefaultConfig()
+	config.Seasons = 2
+	config.PlayersPerSeason = 50
+	config.GamesPerSeason = 0
+	config.SeasonalVariance = 0
+	sim := NewSimulation(config)
+	results := sim.Run()
+	summaries := sim.Summaries
+
+	for s := 0; s < len(summaries); s++ {
+		if summaries[s].ActivePlayers != 0 || summaries[s].Matches != 0 || len(results[s].Ranks) != 0 {
+			t.Errorf("season %d: %d active players, %d matches and %d rank rows, want none", s, summaries[s].ActivePlayers, summaries[s].Matches, len(results[s].Ranks))
+		}
+	}
+	//The output still has to cope with the empty season
+	writeSeasonResult(results[1], &sim.Config)
+	file, err := os.Open("NoDerankNoLearn.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("got %d rows for a season nobody played, want only the header", len(rows))
+	}
+}
+
+func TestNewcomersKeepTheirRank(t *testing.T) {
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 2
+	config.PlayersPerSeason = 50
+	//Nobody plays, so ranks only move with the season setup
+	config.GamesPerSeason = 0
+	config.SeasonalVariance = 0
+	config.NewcomerRankDistribution = make([]float64, config.MaxRank+1)
+	config.NewcomerRankDistribution[10] = 1
+	sim := NewSimulation(config)
+	sim.Run()
+
+	for i := 0; i < len(sim.Players); i++ {
+		if sim.Players[i].JoinedSeason == 1 && sim.Players[i].Rank != 10 {
+			t.Fatalf("player %d joined in season 1 at rank 10, but ended it at rank %d", sim.Players[i].Id, sim.Players[i].Rank)
+		}
+	}
+}
+
+func TestIdleSeasonsBeforeDecay(t *testing.T) {
+	config := DefaultConfig()
+	config.Learn = true
+	config.SkillDecayPerSeason = 0.5
+	config.IdleSeasonsBeforeDecay = 2
+	rng := rand.New(rand.NewSource(1))
+	//No games per season and no variance, so every season is sat out
+	player := Player{GamesPlayed: 100, Skill: Skill{max: 1, rate: 50, mode: "learn", Calc: CalcSkill}}
+
+	for season := 1; season <= 2; season++ {
+		if setPlayerForSeason(&player, false, rng, &config) || player.Skill.offset != 0 {
+			t.Fatalf("idle season %d of a 2 season grace period decayed the player to offset %d", season, player.Skill.offset)
+		}
+	}
+	if !setPlayerForSeason(&player, false, rng, &config) || player.Skill.offset != -50 {
+		t.Fatalf("third idle season in a row: got offset %d, want -50", player.Skill.offset)
+	}
+	if !setPlayerForSeason(&player, false, rng, &config) || player.Skill.offset != -75 {
+		t.Fatalf("fourth idle season in a row: got offset %d, want -75", player.Skill.offset)
+	}
+
+	//Playing a season starts the grace period over
+	player.GamesPerSeason = 10
+	setPlayerForSeason(&player, false, rng, &config)
+	player.GamesPerSeason = 0
+	if setPlayerForSeason(&player, false, rng, &config) || player.Skill.offset != -75 || player.IdleSeasons != 1 {
+		t.Errorf("first idle season after playing decayed to offset %d, or counted %d idle seasons", player.Skill.offset, player.IdleSeasons)
+	}
+
+	//Without a grace period the first idle season decays
+	config.IdleSeasonsBeforeDecay = 0
+	player = Player{GamesPlayed: 100, Skill: Skill{max: 1, rate: 50, mode: "learn", Calc: CalcSkill}}
+	if !setPlayerForSeason(&player, false, rng, &config) || player.Skill.offset != -50 {
+		t.Errorf("first idle season with no grace period: got offset %d, want -50", player.Skill.offset)
+	}
+}
+
+func TestOneWinnerPerMatch(t *testing.T) {
+	models := []string{"linear", "bradleyterry", "logistic"}
+	rng := rand.New(rand.NewSource(1))
+
+	for m := 0; m < len(models); m++ {
+		config := DefaultConfig()
+		config.WinModel = models[m]
+		config.SkillWinWeight = 1
+		config.DrawProbability = 0.1
+		stats := NewSeasonStats(&config)
+		//At full SkillWinWeight equal skills always hit the old tie case, where both players were given the win
+		players, _ := testPlayers([]int{10, 10, 20, 20})
+		players[2].Skill.max = 0.2
+		players[3].Skill.max = 0.9
+
+		for i := 0; i < 2000; i++ {
+			a := &players[2*(i%2)]
+			b := &players[2*(i%2)+1]
+			a.GamesLeft = 10
+			b.GamesLeft = 10
+			aWins, bWins, aLosses, bLosses, aDraws := a.Wins, b.Wins, a.Losses, b.Losses, a.Draws
+
+			outcome, _, _ := playMatch(a, b, stats, rng, &config)
+			wins := a.Wins - aWins + b.Wins - bWins
+			losses := a.Losses - aLosses + b.Losses - bLosses
+			if outcome == 0 {
+				if wins != 0 || losses != 0 || a.Draws-aDraws != 1 {
+					t.Fatalf("%s: a draw gave out %d wins and %d losses", models[m], wins, losses)
+				}
+			} else if wins != 1 || losses != 1 {
+				t.Fatalf("%s: match %d gave out %d wins and %d losses, want one of each", models[m], i, wins, losses)
+			}
+		}
+	}
+}
+
+func TestProgressionWithStalledPlayers(t *testing.T) {
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 2
+	config.PlayersPerSeason = 200
+	//A handful of games each keeps most players at the bottom rank, and some start partway up with short progressions
+	config.GamesPerSeason = 6
+	config.SeasonalVariance = 2
+	config.NewcomerRankDistribution = make([]float64, config.MaxRank+1)
+	config.NewcomerRankDistribution[config.MaxRank] = 0.9
+	config.NewcomerRankDistribution[12] = 0.1
+	sim := NewSimulation(config)
+	results := sim.Run()
+
+	last := results[len(results)-1]
+	bottom := last.Ranks[config.MaxRank]
+	if bottom.PlayerCount*2 < last.TotalPlayers {
+		t.Fatalf("only %d of %d players stalled at rank %d", bottom.PlayerCount, last.TotalPlayers, config.MaxRank)
+	}
+	for r := 0; r < len(last.Ranks); r++ {
+		if math.IsNaN(last.Ranks[r].AvgProgressionCount) || math.IsInf(last.Ranks[r].AvgProgressionCount, 0) {
+			t.Errorf("rank %d progression count is %v", r, last.Ranks[r].AvgProgressionCount)
+		}
+	}
+
+	//A player who started at rank 12 has no entries for the ranks they skipped
+	player := Player{RankProgression: []RankProgression{{Rank: 12, GamesPlayed: 0}, {Rank: 11, GamesPlayed: 7}}}
+	if _, ok := progressionAt(&player, 20); ok {
+		t.Error("found a progression entry for a rank the player never played")
+	}
+	if progression, ok := progressionAt(&player, 11); !ok || progression.GamesPlayed != 7 {
+		t.Errorf("rank 11 progression: got %v %v, want 7 games", progression, ok)
+	}
+}
+
+func TestStdDevMatchesTwoPass(t *testing.T) {
+	config := DefaultConfig()
+	config.Learn = true
+	config.Seed = 1
+	config.Seasons = 3
+	config.PlayersPerSeason = 200
+	sim := NewSimulation(config)
+	results := sim.Run()
+	last := results[len(results)-1]
+
+	for r := 0; r < len(last.Ranks); r++ {
+		skills := make([]float64, 0)
+		for i := 0; i < len(sim.Players); i++ {
+			if sim.Players[i].Rank == r {
+				skills = append(skills, sim.Players[i].Skill.Calc(&sim.Players[i].Skill, sim.Players[i].GamesPlayed))
+			}
+		}
+		if len(skills) == 0 {
+			continue
+		}
+
+		//The old two pass loop, the mean then the population variance around it
+		mean := 0.0
+		for i := 0; i < len(skills); i++ {
+			mean += skills[i]
+		}
+		mean /= float64(len(skills))
+		variance := 0.0
+		for i := 0; i < len(skills); i++ {
+			variance += (skills[i] - mean) * (skills[i] - mean)
+		}
+		stddev := math.Sqrt(variance / float64(len(skills)))
+
+		if math.Abs(last.Ranks[r].AvgSkill-mean) > 1e-9 || math.Abs(last.Ranks[r].StdDev-stddev) > 1e-9 {
+			t.Errorf("rank %d: Welford gave mean %v and stddev %v, two pass %v and %v", r, last.Ranks[r].AvgSkill, last.Ranks[r].StdDev, mean, stddev)
+		}
+	}
+}
+
+func TestMatchProbabilityMatchesRolls(t *testing.T) {
+	config := DefaultConfig()
+	rng := rand.New(rand.NewSource(1))
+	skills := [][2]float64{{0.3, 0.7}, {0.5, 0.5}, {0.9, 0.1}, {0.2, 0.25}}
+	weights := []float64{0, 0.3, 0.7}
+
+	for w := 0; w < len(weights); w++ {
+		config.SkillWinWeight = weights[w]
+		for s := 0; s < len(skills); s++ {
+			a, b := skills[s][0], skills[s][1]
+			wins := 0
+			for i := 0; i < 20000; i++ {
+				if rollOutcome(a, b, 0, rng, &config) == -1 {
+					wins++
+				}
+			}
+			rate := float64(wins) / 20000
+			if chance := matchProbability(a, b, config.SkillWinWeight, config.SkillMin, config.SkillMax); math.Abs(rate-chance) > 0.02 {
+				t.Errorf("SkillWinWeight %v, %v against %v: won %v of rolls, matchProbability says %v", weights[w], a, b, rate, chance)
+			}
+		}
+	}
+}
+
+func TestValidateLearnRate(t *testing.T) {
+	tests := []struct {
+		scale  float64
+		factor float64
+		valid  bool
+	}{
+		{0, 1, false},
+		{-1, 1, false},
+		{1e-9, 1, true},
+		{1, 1, true},
+		{1, 0, false},
+		{1, -0.5, false},
+		{1, 1e-9, true},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < len(tests); n++ {
+		test := tests[n]
+		config := DefaultConfig()
+		config.LearnScale = test.scale
+		config.LearnFactor = test.factor
+		err := config.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("LearnScale %v and LearnFactor %v: got error %v, want valid %v", test.scale, test.factor, err, test.valid)
+			continue
+		}
+		//Anything Validate lets through has to give players a usable learning rate
+		for i := 0; i < 100 && test.valid; i++ {
+			player := NewPlayer(i, 0, 0, 0, 0, rng, &config)
+			if !(player.Skill.rate > 0) || math.IsInf(player.Skill.rate, 0) {
+				t.Fatalf("LearnScale %v and LearnFactor %v: player %d got rate %v", test.scale, test.factor, i, player.Skill.rate)
+			}
+		}
+	}
+}
+
+func TestStreakBonusAfterThreeWins(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  int
+		bonus      int
+		rank       int
+		wantPieces []int
+	}{
+		{"defaults above rank 7", StreakThreshold, StreakBonusPieces, 20, []int{1, 2, 4}},
+		{"defaults at rank 7", StreakThreshold, StreakBonusPieces, 7, []int{1, 2, 3, 4}},
+		{"patched rules", 2, 3, 20, []int{1, 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.StreakThreshold = test.threshold
+			config.StreakBonusPieces = test.bonus
+			//Few enough wins that the streak doesn't rank the player up
+			player := Player{Rank: test.rank, GamesLeft: len(test.wantPieces) + 1}
+			player.RankProgression = []RankProgression{{Rank: test.rank}}
+
+			for w := 0; w < len(test.wantPieces); w++ {
+				addWin(&player, &config)
+				if player.Pieces != test.wantPieces[w] {
+					t.Fatalf("after %d wins in a row: got %d pieces, want %d", w+1, player.Pieces, test.wantPieces[w])
+				}
+			}
+		})
+	}
+}
+
+func TestGiniCoefficient(t *testing.T) {
+	oneHolds := make([]float64, 1000)
+	oneHolds[500] = 3
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"empty", []float64{}, 0},
+		{"all zero", []float64{0, 0, 0}, 0},
+		{"perfectly equal", []float64{0.4, 0.4, 0.4, 0.4}, 0},
+		{"one player holds everything", oneHolds, 0.999},
+		{"one to five", []float64{5, 1, 4, 2, 3}, 4.0 / 15.0},
+	}
+	for _, test := range tests {
+		if got := giniCoefficient(test.values); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	//Always in [0, 1) for non-negative values
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		values := make([]float64, 1+rng.Intn(50))
+		for v := 0; v < len(values); v++ {
+			values[v] = rng.Float64()
+		}
+		if got := giniCoefficient(values); got < 0 || got >= 1 {
+			t.Fatalf("got %v for %v", got, values)
+		}
+	}
+}
+
+type logCapture struct {
+	lines []string
+}
+
+func (capture *logCapture) Write(p []byte) (int, error) {
+	capture.lines = append(capture.lines, string(p))
+	return len(p), nil
+}
+
+func (capture *logCapture) contains(text string) bool {
+	for i := 0; i < len(capture.lines); i++ {
+		if strings.Contains(capture.lines[i], text) {
+			return true
+		}
+	}
+	return false
+}
+
+func captureLog(t *testing.T) *logCapture {
+	capture := &logCapture{}
+	log.SetOutput(capture)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+	return capture
+}
+
+func runWithin(t *testing.T, sim *Simulation, limit time.Duration) {
+	done := make(chan bool)
+	go func() {
+		sim.Run()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(limit):
+		t.Fatalf("%d seasons of %d players each didn't finish in %v", sim.Config.Seasons, sim.Config.PlayersPerSeason, limit)
+	}
+}
+
+func TestTinyPopulationFinishes(t *testing.T) {
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 3
+	config.PlayersPerSeason = 2
+
+	//Both start at the bottom rank, so they can only play each other
+	sim := NewSimulation(config)
+	runWithin(t, sim, 10*time.Second)
+	if sim.Summaries[0].Matches == 0 {
+		t.Error("two players at the same rank never played each other")
+	}
+
+	//Nobody has games, so there's nobody to match
+	capture := captureLog(t)
+	config.GamesPerSeason = 0
+	config.SeasonalVariance = 0
+	sim = NewSimulation(config)
+	runWithin(t, sim, 10*time.Second)
+	if !capture.contains("player(s) with games, the population is too small to match across") {
+		t.Errorf("no population warning was logged, got %v", capture.lines)
+	}
+
+	//Two players too far apart to reach each other
+	config.Seasons = 1
+	config.MatchSearchWidth = 1
+	sim = NewSimulation(config)
+	sim.Players, _ = testPlayers([]int{5, 25})
+	sim.NextId = len(sim.Players)
+	runWithin(t, sim, 10*time.Second)
+	if !capture.contains("played no matches with 2 players") {
+		t.Errorf("no warning for a season without matches, got %v", capture.lines)
+	}
+}
+
+func TestMedianSkillEvenCount(t *testing.T) {
+	if got := medianFloat([]float64{0.1, 0.2, 0.4, 0.9}); math.Abs(got-0.3) > 1e-12 {
+		t.Errorf("medianFloat of an even count: got %v, want 0.3", got)
+	}
+	if got := medianFloat([]float64{0.1, 0.2, 0.9}); got != 0.2 {
+		t.Errorf("medianFloat of an odd count: got %v, want 0.2", got)
+	}
+
+	//Four players at rank 12, given out of order
+	config := DefaultConfig()
+	players, _ := testPlayers([]int{12, 12, 12, 12})
+	skills := []float64{0.9, 0.1, 0.4, 0.2}
+	for i := 0; i < len(players); i++ {
+		players[i].Skill.max = skills[i]
+	}
+	stats := NewSeasonStats(&config)
+	stats.ActivePlayers = len(players)
+
+	result := endStats(&players, 0, stats, &config)
+	if got := result.Ranks[12].MedianSkill; math.Abs(got-0.3) > 1e-12 {
+		t.Errorf("rank 12 median skill: got %v, want 0.3", got)
+	}
+}
+
+func TestEmptyRankStats(t *testing.T) {
+	capture := captureLog(t)
+	config := DefaultConfig()
+	//One player at rank 12 who never played, every other rank empty and no matches recorded
+	players, _ := testPlayers([]int{12})
+	stats := NewSeasonStats(&config)
+	stats.ActivePlayers = len(players)
+
+	result := endStats(&players, 0, stats, &config)
+	if capture.contains("NaN") {
+		t.Errorf("NaN logged for empty ranks: %v", capture.lines)
+	}
+	if len(result.Ranks) != config.MaxRank+1 {
+		t.Fatalf("got %d ranks, want %d", len(result.Ranks), config.MaxRank+1)
+	}
+	for r := 0; r < len(result.Ranks); r++ {
+		stat := result.Ranks[r]
+		if stat.FavoriteWinRate != nil || stat.NewcomerWinRate != nil || stat.AvgWinRate != nil || stat.AvgDrawRate != nil {
+			t.Errorf("rank %d has a rate without any matches", r)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	if e := estimate(nil); e.Runs != 0 || e.Mean != 0 || e.HalfWidth != 0 {
+		t.Errorf("no runs: got %+v, want a zero estimate", e)
+	}
+	if e := estimate([]float64{0.4}); e.Runs != 1 || e.Mean != 0.4 || e.HalfWidth != 0 {
+		t.Errorf("one run: got %+v, want mean 0.4 without a half width", e)
+	}
+	//Sample variance of 1 and 3 is 2, so the half width is 1.96 * sqrt(2 / 2)
+	if e := estimate([]float64{1, 3}); e.Runs != 2 || e.Mean != 2 || math.Abs(e.HalfWidth-1.96) > 1e-12 {
+		t.Errorf("two runs: got %+v, want mean 2 ± 1.96", e)
+	}
+
+	//A single run leaves the CI cells blank rather than writing NaN
+	inTempDir(t)
+	config := DefaultConfig()
+	aggregate := []AggregateRankStat{{Rank: 0, PlayerCount: estimate([]float64{5}), AvgSkill: estimate([]float64{0.5}), StdDev: estimate([]float64{0.1})}}
+	writeAggregate(aggregate, &config)
+	file, err := os.Open(outputName(&config) + "Aggregate.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := 2; c < len(rows[1]); c += 3 {
+		if rows[1][c] != "" {
+			t.Errorf("%s: got %q for a single run, want it blank", rows[0][c], rows[1][c])
+		}
+	}
+}
+
+func TestResumeMatchesUninterruptedRun(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 3
+	config.PlayersPerSeason = 200
+	full := NewSimulation(config)
+	full.Run()
+
+	//Stop after two seasons, then pick the third back up from the snapshot
+	config.Seasons = 2
+	config.Snapshot = "state.gob"
+	NewSimulation(config).Run()
+	config.Seasons = 3
+	config.Snapshot = ""
+	resumed, err := Resume("state.gob", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed.Run()
+
+	if len(resumed.Players) != len(full.Players) {
+		t.Fatalf("resumed run has %d players, want %d", len(resumed.Players), len(full.Players))
+	}
+	if got, want := resumed.Summaries[0].Matches, full.Summaries[2].Matches; got != want {
+		t.Errorf("resumed season played %d matches, want %d", got, want)
+	}
+	for i := 0; i < len(full.Players); i++ {
+		if resumed.Players[i].Rank != full.Players[i].Rank || resumed.Players[i].GamesPlayed != full.Players[i].GamesPlayed {
+			t.Fatalf("player %d ended at rank %d after %d games, want rank %d after %d", i, resumed.Players[i].Rank, resumed.Players[i].GamesPlayed, full.Players[i].Rank, full.Players[i].GamesPlayed)
+		}
+	}
+}
+
+func TestResumeRejectsRanksPastMaxRank(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 1
+	config.PlayersPerSeason = 200
+	config.Snapshot = "state.gob"
+	NewSimulation(config).Run()
+
+	//New players start at rank 30, past the end of a 15 rank ladder
+	config.Seasons = 2
+	config.Snapshot = ""
+	config.MaxRank = 15
+	config.FreeLossRank = 15
+	config.LossStreakRank = 7
+	if _, err := Resume("state.gob", config); err == nil {
+		t.Error("a snapshot with players past MaxRank resumed")
+	}
+}
+
+func TestPiecesPerRank(t *testing.T) {
+	values := []int{1, 3, 5, 8}
+	for v := 0; v < len(values); v++ {
+		config := DefaultConfig()
+		config.PiecesPerRank = values[v]
+		config.NoStreakBonus = true
+		config.Derank = true
+		player := Player{Rank: 10, GamesLeft: 100}
+		player.RankProgression = []RankProgression{{Rank: 10}}
+
+		//PiecesPerRank wins fill the rank, the next one ranks up with a piece to spare
+		for w := 0; w < values[v]; w++ {
+			addWin(&player, &config)
+		}
+		if player.Rank != 10 || player.Pieces != values[v] {
+			t.Errorf("PiecesPerRank %d: after %d wins got rank %d with %d pieces, want rank 10 with %d", values[v], values[v], player.Rank, player.Pieces, values[v])
+		}
+		addWin(&player, &config)
+		if player.Rank != 9 || player.Pieces != 1 {
+			t.Errorf("PiecesPerRank %d: after %d wins got rank %d with %d pieces, want rank 9 with 1", values[v], values[v]+1, player.Rank, player.Pieces)
+		}
+
+		//A derank lands with a full rank of pieces
+		player = Player{Rank: 10, GamesLeft: 1}
+		addLoss(&player, &config)
+		if player.Rank != 11 || player.Pieces != values[v] {
+			t.Errorf("PiecesPerRank %d: derank got rank %d with %d pieces, want rank 11 with %d", values[v], player.Rank, player.Pieces, values[v])
+		}
+	}
+}
+
+func TestProGamesAreMatches(t *testing.T) {
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 4
+	config.PlayersPerSeason = 200
+	config.Learn = true
+	//Start some players near the top so they reach Pro Rank mid season and stop matching
+	config.NewcomerRankDistribution = make([]float64, config.MaxRank+1)
+	config.NewcomerRankDistribution[2] = 0.5
+	config.NewcomerRankDistribution[config.MaxRank] = 0.5
+	sim := NewSimulation(config)
+	sim.Run()
+
+	pros := 0
+	for i := 0; i < len(sim.Players); i++ {
+		p := &sim.Players[i]
+		if p.Rank == 0 {
+			pros++
+		}
+		if p.GamesPlayed != p.Wins+p.Losses+p.Draws {
+			t.Errorf("player %d at rank %d has %d games played from %d matches", i, p.Rank, p.GamesPlayed, p.Wins+p.Losses+p.Draws)
+		}
+	}
+	if pros == 0 {
+		t.Fatal("nobody reached Pro Rank, nobody was kept out of matches")
+	}
+}
+
+func TestProRankSize10(t *testing.T) {
+	rating := func(p *Player) float64 { return p.Skill.max }
+	counts := []int{0, 3, 10, 11, 25}
+	for c := 0; c < len(counts); c++ {
+		players, _ := testPlayers(make([]int, counts[c]))
+		pros := make([]*Player, counts[c])
+		for i := 0; i < counts[c]; i++ {
+			players[i].Skill.max = float64(i) / 100
+			pros[i] = &players[i]
+		}
+
+		//Everyone makes the cut until there are more than 10, then it's the 10th best rating
+		want := 0.0
+		if counts[c] > 10 {
+			want = float64(counts[c]-10) / 100
+		}
+		if got := proRankCutoff(pros, 10, rating); got != want {
+			t.Errorf("%d pro players: got cutoff %v, want %v", counts[c], got, want)
+		}
+	}
+
+	//A few players reach Pro Rank each season, hovering around the cut
+	config := DefaultConfig()
+	config.Seed = 1
+	config.PlayersPerSeason = 200
+	config.ProRankSize = 10
+	config.Seasons = 4
+	config.NewcomerRankDistribution = make([]float64, config.MaxRank+1)
+	config.NewcomerRankDistribution[1] = 0.1
+	config.NewcomerRankDistribution[config.MaxRank] = 0.9
+	NewSimulation(config).Run()
+}
+
+func BenchmarkSeason(b *testing.B) {
+	//One season of 5000 new players on a fixed seed, the same matches every iteration
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 1
+	config.PlayersPerSeason = 5000
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		sim := NewSimulation(config)
+		sim.runSeason(0, nil)
+	}
+}
+
+func BenchmarkSeasons(b *testing.B) {
+	//Twelve seasons on a growing population, where the rank buckets get reused from one season to the next
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 12
+	config.PlayersPerSeason = 500
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		NewSimulation(config).Run()
+	}
+}
+
+func TestBucketReuseKeepsOutput(t *testing.T) {
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 4
+	config.PlayersPerSeason = 200
+	config.Derank = true
+	reused := NewSimulation(config)
+	fresh := NewSimulation(config)
+
+	for s := 0; s < config.Seasons; s++ {
+		reused.runSeason(s, nil)
+		//As every season was before the buckets were kept
+		fresh.buckets = nil
+		fresh.runSeason(s, nil)
+	}
+
+	for s := 0; s < config.Seasons; s++ {
+		if reused.Summaries[s].Matches != fresh.Summaries[s].Matches {
+			t.Errorf("season %d: %d matches with reused buckets, %d with fresh ones", s, reused.Summaries[s].Matches, fresh.Summaries[s].Matches)
+		}
+	}
+	for i := 0; i < len(reused.Players); i++ {
+		a := &reused.Players[i]
+		b := &fresh.Players[i]
+		if a.Rank != b.Rank || a.Pieces != b.Pieces || a.GamesPlayed != b.GamesPlayed || a.Wins != b.Wins {
+			t.Fatalf("player %d differs between reused and fresh buckets", i)
+		}
+	}
+}
+
+func TestEmptyRanksHaveNoNaN(t *testing.T) {
+	systems := []string{"pieces", "elo", "glicko", "mmr"}
+	for i := 0; i < len(systems); i++ {
+		config := DefaultConfig()
+		config.Seed = 1
+		config.Seasons = 2
+		config.PlayersPerSeason = 50
+		config.RatingSystem = systems[i]
+		results := NewSimulation(config).Run()
+
+		empty := 0
+		for r := 0; r < len(results[1].Ranks); r++ {
+			if results[1].Ranks[r].PlayerCount == 0 {
+				empty++
+			}
+		}
+		if empty == 0 {
+			t.Fatalf("%s: no rank was left empty", systems[i])
+		}
+		//encoding/json refuses NaN, so this fails if any rank stat is one
+		if _, err := json.Marshal(results); err != nil {
+			t.Errorf("%s: %v", systems[i], err)
+		}
+	}
+}
+
+func TestRunWithPlayers(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 2
+	ranks := make([]int, 200)
+	for i := 0; i < len(ranks); i++ {
+		ranks[i] = i % (config.MaxRank + 1)
+	}
+	players, _ := testPlayers(ranks)
+	for i := 0; i < len(players); i++ {
+		players[i].GamesPerSeason = 20
+		players[i].RankProgression = nil
+	}
+
+	results, err := RunWithPlayers(players, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := 0; s < len(results); s++ {
+		//Nobody joins the given players
+		if results[s].TotalPlayers != len(players) {
+			t.Errorf("season %d has %d players, want the %d given", s, results[s].TotalPlayers, len(players))
+		}
+	}
+	matches := 0
+	for i := 0; i < len(players); i++ {
+		matches += players[i].Wins + players[i].Losses + players[i].Draws
+	}
+	if matches == 0 {
+		t.Error("the given players never played")
+	}
+
+	//A player's Id is their index, so a gap is rejected
+	players, _ = testPlayers([]int{5, 5})
+	players[1].Id = 2
+	if _, err := RunWithPlayers(players, config); err == nil {
+		t.Error("misnumbered Ids were accepted")
+	}
+}
+
+func TestPlayersCSVRoundTrip(t *testing.T) {
+	inTempDir(t)
+	config := DefaultConfig()
+	config.Seed = 1
+	config.Seasons = 1
+	config.PlayersPerSeason = 200
+	config.SkillMin = 0.3
+	config.SkillMax = 0.8
+	sim := NewSimulation(config)
+	sim.Run()
+
+	path := "players.csv"
+	if err := WritePlayersCSV(path, sim.Players); err != nil {
+		t.Fatal(err)
+	}
+	players, err := LoadPlayersCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(players) != len(sim.Players) {
+		t.Fatalf("read back %d players, want %d", len(players), len(sim.Players))
+	}
+	for i := 0; i < len(players); i++ {
+		got, want := &players[i], &sim.Players[i]
+		if got.Id != want.Id || got.Skill.max != want.Skill.max || got.Skill.offset != want.Skill.offset || got.Skill.rate != want.Skill.rate || got.GamesPerSeason != want.GamesPerSeason || got.Rank != want.Rank {
+			t.Fatalf("player %d read back as %+v, want %+v", i, got, want)
+		}
+	}
+
+	if _, err := RunWithPlayers(players, config); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(players); i++ {
+		//MMR starts at the middle of the band, and only moves with RatingSystem "mmr"
+		if math.Abs(players[i].MMR-0.55) > 1e-12 {
+			t.Fatalf("player %d has MMR %v, want 0.55", i, players[i].MMR)
+		}
+	}
+
+	//The file only knows [0, 1], the band and MaxRank are checked when the players are run
+	header := "Id,Skill Max,Skill Offset,Skill Rate,Games Per Season,Rank\n"
+	bad := []string{"0,0.9,0,1,10,5\n", "0,0.2,0,1,10,5\n", "0,0.5,0,1,10,31\n"}
+	for i := 0; i < len(bad); i++ {
+		players, err := LoadPlayersCSV(writeTestFile(t, "bad.csv", header+bad[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RunWithPlayers(players, config); err == nil {
+			t.Errorf("row %q was run", strings.TrimSpace(bad[i]))
+		}
+	}
+}
+
+func TestDiffCSV(t *testing.T) {
+	a := writeTestFile(t, "a.csv", "Rank,Player Count,Average Skill\n0,10,0.5\n1,20,n/a\n")
+	b := writeTestFile(t, "b.csv", "Rank,Player Count,Average Skill\n0,10,0.5001\n1,21,n/a\n")
+
+	diffs, err := DiffCSV(a, a, 0)
+	if err != nil || len(diffs) != 0 {
+		t.Errorf("a file against itself: got %v %v", diffs, err)
+	}
+	diffs, err = DiffCSV(a, b, 0.001)
+	if err != nil || len(diffs) != 1 || diffs[0] != "Rank 1, Player Count: 20 -> 21" {
+		t.Errorf("within a tolerance of 0.001: got %v %v", diffs, err)
+	}
+	diffs, _ = DiffCSV(a, b, 0)
+	if len(diffs) != 2 {
+		t.Errorf("with no tolerance: got %v", diffs)
+	}
+
+	short := writeTestFile(t, "short.csv", "Rank,Player Count,Average Skill\n0,10,0.5\n")
+	if diffs, _ := DiffCSV(a, short, 0); len(diffs) != 1 {
+		t.Errorf("missing row: got %v", diffs)
+	}
+	other := writeTestFile(t, "other.csv", "Rank,Players\n0,10\n")
+	if diffs, _ := DiffCSV(a, other, 0); len(diffs) != 1 {
+		t.Errorf("different headers: got %v", diffs)
+	}
+}
+
+func TestEquilibriumSeason(t *testing.T) {
+	summaries := []SeasonSummary{
+		{Season: 0, RankShares: []float64{0, 0.2, 0.8}},
+		{Season: 1, RankShares: []float64{0.1, 0.3, 0.6}},
+		{Season: 2, RankShares: []float64{0.1, 0.35, 0.55}},
+		{Season: 3, RankShares: []float64{0.11, 0.35, 0.54}},
+		{Season: 4, RankShares: []float64{0.11, 0.35, 0.54}},
+	}
+	if season, change := equilibriumSeason(summaries, 0.02); season != 3 || math.Abs(change-0.01) > 1e-9 {
+		t.Errorf("got season %d with a change of %v, want season 3 with 0.01", season, change)
+	}
+	if season, _ := equilibriumSeason(summaries, 0.001); season != 4 {
+		t.Errorf("at a tighter tolerance got season %d, want 4", season)
+	}
+	if season, _ := equilibriumSeason(summaries[:3], 0.02); season != -1 {
+		t.Errorf("got season %d before the shares settled, want -1", season)
+	}
+
+	//Retired players aren't on the ladder
+	config := DefaultConfig()
+	config.MaxRank = 2
+	players, _ := testPlayers([]int{0, 2, 2, 1})
+	players[3].Retired = true
+	shares := rankShares(players, &config)
+	if math.Abs(shares[0]-1.0/3) > 1e-9 || shares[1] != 0 || math.Abs(shares[2]-2.0/3) > 1e-9 {
+		t.Errorf("got rank shares %v", shares)
+	}
+}
+
+func TestValidateNewcomerRankDistribution(t *testing.T) {
+	tests := []struct {
+		distribution []float64
+		valid        bool
+	}{
+		{[]float64{}, true},
+		{[]float64{0, 0.5, 0.5}, true},
+		{[]float64{0, 0, 0}, false},
+		{[]float64{0.5, -0.1, 0.6}, false},
+	}
+
+	for n := 0; n < len(tests); n++ {
+		config := DefaultConfig()
+		config.NewcomerRankDistribution = tests[n].distribution
+		err := config.Validate()
+		if (err == nil) != tests[n].valid {
+			t.Errorf("NewcomerRankDistribution %v: got error %v, want valid %v", tests[n].distribution, err, tests[n].valid)
+		}
+	}
+}
+
+func TestValidateRankUpStartingPieces(t *testing.T) {
+	config := DefaultConfig()
+	config.RankUpStartingPieces = make([]int, config.MaxRank+1)
+	if err := config.Validate(); err != nil {
+		t.Errorf("an entry for every rank failed Validate: %v", err)
+	}
+
+	config.RankUpStartingPieces = make([]int, config.MaxRank+2)
+	if config.Validate() == nil {
+		t.Error("more entries than ranks passed Validate")
+	}
+
+	config.RankUpStartingPieces = []int{0, 4, -1}
+	if config.Validate() == nil {
+		t.Error("a negative entry passed Validate")
+	}
+}
+
+func TestMatchProbabilityNarrowBand(t *testing.T) {
+	narrow := DefaultConfig()
+	narrow.SkillMin = 0.9
+	narrow.SkillMax = 1.0
+	wide := DefaultConfig()
+	skills := [][2]float64{{0.98, 0.92}, {0.95, 0.91}, {0.99, 0.9}}
+
+	for s := 0; s < len(skills); s++ {
+		a, b := skills[s][0], skills[s][1]
+		p := winProbability(a, b, &narrow)
+		if p <= 0.5 {
+			t.Errorf("%v against %v in [0.9, 1]: the stronger player wins %v", a, b, p)
+		}
+		//Without draws someone wins, whoever is a
+		if sum := p + winProbability(b, a, &narrow); math.Abs(sum-1) > 1e-12 {
+			t.Errorf("%v against %v in [0.9, 1]: chances add up to %v", a, b, sum)
+		}
+		//The same place in the band plays the same, so 0.98 against 0.92 is 0.8 against 0.2 on [0, 1]
+		if want := winProbability((a-0.9)/0.1, (b-0.9)/0.1, &wide); math.Abs(p-want) > 1e-9 {
+			t.Errorf("%v against %v in [0.9, 1]: got %v, want %v", a, b, p, want)
+		}
+	}
+
+	//SkillWinWeight still favors the stronger player
+	narrow.SkillWinWeight = 0.5
+	if p := winProbability(0.96, 0.93, &narrow); p <= 0.5 {
+		t.Errorf("0.96 against 0.93 in [0.9, 1] at SkillWinWeight 0.5: the stronger player wins %v", p)
+	}
+}
+
+func TestSkillGamesCorrelation(t *testing.T) {
+	tests := []struct {
+		correlation float64
+		min         float64
+		max         float64
+	}{
+		{0, -0.1, 0.1},
+		{0.5, 0.4, 0.6},
+		{1, 0.99, 1.01},
+	}
+
+	for n := 0; n < len(tests); n++ {
+		config := DefaultConfig()
+		config.SkillGamesCorrelation = tests[n].correlation
+		rng := rand.New(rand.NewSource(1))
+		nextId := 0
+		players := initPlayers(2000, config.GamesPerSeason, &nextId, 0, rng, &config)
+
+		skills := make([]float64, 0)
+		games := make([]float64, 0)
+		for i := 0; i < len(players); i++ {
+			skills = append(skills, players[i].Skill.max)
+			games = append(games, float64(players[i].GamesPerSeason))
+		}
+		if r := correlation(skills, games); r < tests[n].min || r > tests[n].max {
+			t.Errorf("SkillGamesCorrelation %v: max skill and games per season correlate at %v, want %v to %v", tests[n].correlation, r, tests[n].min, tests[n].max)
+		}
+	}
+}